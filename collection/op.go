@@ -0,0 +1,112 @@
+package collection
+
+import "encoding/xml"
+
+/*
+<response status="success">
+  <result>
+    <entry ip="10.10.10.10" from_agent="0" persistent="1">
+      <tag>
+        <member>tag10</member>
+      </tag>
+    </entry>
+    <count>1</count>
+  </result>
+</response>
+*/
+
+// RegisteredIPResponse is the placeholder for the response of the "show object registered-ip all" op command
+type RegisteredIPResponse struct {
+	XMLName xml.Name            `xml:"response"`
+	Status  string              `xml:"status,attr"`
+	Result  *RegisteredIPResult `xml:"result,omitempty"`
+}
+
+// RegisteredIPResult is the list of ip-to-tag entries known by the device
+type RegisteredIPResult struct {
+	Entry []RegisteredIPEntry `xml:"entry"`
+	Count int                 `xml:"count"`
+}
+
+// RegisteredIPEntry contains the tags registered for a single IP. FromAgent is the User-ID agent (source) that
+// registered them ("0" for the XML API)
+type RegisteredIPEntry struct {
+	IP         string               `xml:"ip,attr"`
+	FromAgent  string               `xml:"from_agent,attr"`
+	Persistent string               `xml:"persistent,attr"`
+	Tag        UIDMsgPldDxGEntryTag `xml:"tag"`
+}
+
+/*
+<response status="success">
+  <result>
+    <entry>
+      <ip>10.10.10.10</ip>
+      <vsys>vsys1</vsys>
+      <type>XMLAPI</type>
+      <user>foo@test.local</user>
+      <idle_timeout>3540</idle_timeout>
+      <timeout>3540</timeout>
+      <maxtimeout>3540</maxtimeout>
+    </entry>
+    <count>1</count>
+  </result>
+</response>
+*/
+
+// IPUserMappingResponse is the placeholder for the response of the "show user ip-user-mapping all" op command
+type IPUserMappingResponse struct {
+	XMLName xml.Name             `xml:"response"`
+	Status  string               `xml:"status,attr"`
+	Result  *IPUserMappingResult `xml:"result,omitempty"`
+}
+
+// IPUserMappingResult is the list of user-to-ip entries known by the device
+type IPUserMappingResult struct {
+	Entry []IPUserMappingEntry `xml:"entry"`
+	Count int                  `xml:"count"`
+}
+
+// IPUserMappingEntry contains data for a single user-to-ip entry. Type is the source of the mapping
+// (i.e. "XMLAPI", "AD", "GP") and timeouts are expressed in seconds (or "Never")
+type IPUserMappingEntry struct {
+	IP          string `xml:"ip"`
+	Vsys        string `xml:"vsys"`
+	Type        string `xml:"type"`
+	User        string `xml:"user"`
+	IdleTimeout string `xml:"idle_timeout"`
+	Timeout     string `xml:"timeout"`
+	MaxTimeout  string `xml:"maxtimeout"`
+}
+
+/*
+<response status="success">
+  <result>
+    <entry user="foo@test.local">
+      <tag>
+        <member>admin</member>
+      </tag>
+    </entry>
+    <count>1</count>
+  </result>
+</response>
+*/
+
+// RegisteredUserResponse is the placeholder for the response of the "show object registered-user all" op command
+type RegisteredUserResponse struct {
+	XMLName xml.Name              `xml:"response"`
+	Status  string                `xml:"status,attr"`
+	Result  *RegisteredUserResult `xml:"result,omitempty"`
+}
+
+// RegisteredUserResult is the list of user-to-group (DUG) entries known by the device
+type RegisteredUserResult struct {
+	Entry []RegisteredUserEntry `xml:"entry"`
+	Count int                   `xml:"count"`
+}
+
+// RegisteredUserEntry contains the tags (groups) registered for a single user
+type RegisteredUserEntry struct {
+	User string               `xml:"user,attr"`
+	Tag  UIDMsgPldDxGEntryTag `xml:"tag"`
+}
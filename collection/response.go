@@ -16,18 +16,36 @@ import "encoding/xml"
 </response>
 */
 
-// APIResponse is the placeholder for a PAN-OS XML API Response
+/*
+<response status="error" code="403">
+  <result>
+    <msg>Invalid credentials.</msg>
+  </result>
+</response>
+*/
+
+// APIResponse is the placeholder for a PAN-OS XML API Response. Code is only present in error responses
 type APIResponse struct {
 	XMLName xml.Name `xml:"response"`
 	Status  string   `xml:"status,attr"`
+	Code    string   `xml:"code,attr,omitempty"`
 	Result  *struct {
-		UidResponse *UIDResponse `xml:"uid-response"`
+		UidResponse *UIDResponse    `xml:"uid-response"`
+		Msg         *APIResponseMsg `xml:"msg,omitempty"`
 	} `xml:"result,omitempty"`
-	Msg *struct {
-		Line []struct {
-			UidResponse *UIDResponse `xml:"uid-response"`
-		} `xml:"line"`
-	} `xml:"msg,omitempty"`
+	Msg *APIResponseMsg `xml:"msg,omitempty"`
+}
+
+// APIResponseMsg is the message of a PAN-OS XML API Response. It can be either a text or a list of lines
+type APIResponseMsg struct {
+	Text string            `xml:",chardata"`
+	Line []APIResponseLine `xml:"line"`
+}
+
+// APIResponseLine is a single line of a PAN-OS XML API Response message
+type APIResponseLine struct {
+	Text        string       `xml:",chardata"`
+	UidResponse *UIDResponse `xml:"uid-response"`
 }
 
 // UIDResponse is the placeholder for a PAN-OS XML UserID API Response
@@ -40,11 +58,36 @@ type UIDResponse struct {
 		Register *struct {
 			Entry []UIDResponseEntry `xml:"entry"`
 		} `xml:"register"`
+		UnregisterUser *struct {
+			Entry []UIDResponseEntry `xml:"entry"`
+		} `xml:"unregister-user"`
+		RegisterUser *struct {
+			Entry []UIDResponseEntry `xml:"entry"`
+		} `xml:"register-user"`
 	} `xml:"payload"`
 }
 
-// UIDResponseEntry is a PAN-OS XML UserID API Response item
+// UIDResponseEntry is a PAN-OS XML UserID API Response item. IP is used in DAG (register / unregister)
+// items and User in DUG (register-user / unregister-user) ones
 type UIDResponseEntry struct {
-	IP  string `xml:"ip,attr"`
-	Msg string `xml:"message,attr"`
+	IP   string `xml:"ip,attr,omitempty"`
+	User string `xml:"user,attr,omitempty"`
+	Msg  string `xml:"message,attr"`
+}
+
+/*
+<response status="success">
+  <result>
+    <key>LUFRPT1...</key>
+  </result>
+</response>
+*/
+
+// KeygenResponse is the placeholder for a PAN-OS XML API keygen Response
+type KeygenResponse struct {
+	XMLName xml.Name `xml:"response"`
+	Status  string   `xml:"status,attr"`
+	Result  *struct {
+		Key string `xml:"key"`
+	} `xml:"result,omitempty"`
 }
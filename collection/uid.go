@@ -25,6 +25,7 @@ type UIDMsgPayload struct {
 	UnregisterUser *UIDMsgPldDUGRegUnreg `xml:"unregister-user,omitempty"`
 	Login          *UIDMsgPldLogInOut    `xml:"login,omitempty"`
 	Logout         *UIDMsgPldLogInOut    `xml:"logout,omitempty"`
+	Groups         *UIDMsgPldGroups      `xml:"groups,omitempty"`
 }
 
 // UIDMsgPldLogInOut is the list of entries for a UserID login or logout operation
@@ -39,6 +40,45 @@ type UIDMsgPldLogEntry struct {
 	Timeout *string `xml:"timeout,attr,omitempty"`
 }
 
+/* UIDMsgPldGroups is the list of entries for a UserID group mapping operation. Every entry contains the full
+list of members of a group (it replaces any previous list)
+
+Example User-ID group mapping payload
+
+<uid-message>
+	<type>update</type>
+	<payload>
+		<groups>
+			<entry name="cn=admin,dc=test,dc=local">
+				<members>
+					<entry name="foo@test.local"/>
+					<entry name="bar@test.local"/>
+				</members>
+			</entry>
+		</groups>
+	</payload>
+</uid-message>
+*/
+type UIDMsgPldGroups struct {
+	Entry []UIDMsgPldGroupEntry `xml:"entry"`
+}
+
+// UIDMsgPldGroupEntry contains the member list of a single group
+type UIDMsgPldGroupEntry struct {
+	Name    string                `xml:"name,attr"`
+	Members UIDMsgPldGroupMembers `xml:"members"`
+}
+
+// UIDMsgPldGroupMembers is the list of members of a group
+type UIDMsgPldGroupMembers struct {
+	Entry []UIDMsgPldGroupMember `xml:"entry"`
+}
+
+// UIDMsgPldGroupMember data for a single group member
+type UIDMsgPldGroupMember struct {
+	Name string `xml:"name,attr"`
+}
+
 /* UIDMsgPldDUGRegUnreg is the list of entries for a UserID Dynamic User Group (register / unregister) operation
 
 Example User-ID DUG payload
@@ -0,0 +1,368 @@
+/*
+package panostest provides a stand-in for the PAN-OS XML API meant to be used in integration tests together
+with the net/http/httptest package.
+
+The Handler implements the User-ID (type=user-id), key generation (type=keygen) and the "show object
+registered-ip all", "show user ip-user-mapping all" and "show object registered-user all" operational
+commands. User-ID messages are applied to a uidmonitor.MemMonitor and the responses mimic the ones of a
+real device, including the per-entry messages for registering existing entries or unregistering non
+existing ones. The operational commands report the remaining timeout of the entries (entries added without
+a timeout are reported as never expiring ip-user-mappings and without timeout otherwise).
+
+	h := panostest.NewHandler(uidmonitor.NewMemMonitor(), "apikey")
+	srv := httptest.NewTLSServer(h)
+	defer srv.Close()
+	resp, err := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		Push(srv.Listener.Addr().String(), "apikey", srv.Client(), nil)
+*/
+package panostest
+
+import (
+	"crypto/subtle"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	x "github.com/xhoms/panoslib/collection"
+	"github.com/xhoms/panoslib/uid"
+	"github.com/xhoms/panoslib/uidmonitor"
+)
+
+// Fault describes the failures the Handler injects in its responses
+type Fault struct {
+	// Latency delays every response
+	Latency time.Duration
+	// Status replies with this HTTP status code (i.e. 503) instead of processing the request
+	Status int
+	// Malformed replies with a truncated XML document instead of processing the request
+	Malformed bool
+	// Count is the number of requests the fault applies to. Zero means all of them
+	Count int
+}
+
+// Handler implements http.Handler simulating the PAN-OS XML API of a device. Use an initialized version as
+// provided by NewHandler()
+type Handler struct {
+	monitor                *uidmonitor.MemMonitor
+	apikey, user, password string
+	lock                   *sync.Mutex
+	fault                  Fault
+	faulty                 int
+	requests               int
+}
+
+// NewHandler returns a ready-to-consume Handler that applies User-ID messages to m and accepts requests
+// authenticated with apikey (either in the form values or in the X-PAN-KEY header)
+func NewHandler(m *uidmonitor.MemMonitor, apikey string) (h *Handler) {
+	h = &Handler{
+		monitor: m,
+		apikey:  apikey,
+		lock:    &sync.Mutex{},
+	}
+	return
+}
+
+// Credentials enables the keygen endpoint. Requests with these credentials get the API key of the Handler
+func (h *Handler) Credentials(user, password string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.user, h.password = user, password
+}
+
+// Inject configures the failures injected in the following responses. A zero Fault disables them
+func (h *Handler) Inject(f Fault) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.fault, h.faulty = f, 0
+}
+
+// Monitor returns the MemMonitor the User-ID messages are applied to
+func (h *Handler) Monitor() *uidmonitor.MemMonitor {
+	return h.monitor
+}
+
+// Requests returns the number of requests received so far
+func (h *Handler) Requests() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.requests
+}
+
+// nextFault returns the fault to apply to the current request
+func (h *Handler) nextFault() (f Fault) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.requests++
+	if h.fault.Count == 0 || h.faulty < h.fault.Count {
+		f = h.fault
+		h.faulty++
+	}
+	return
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f := h.nextFault()
+	if f.Latency > 0 {
+		timer := time.NewTimer(f.Latency)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+	switch {
+	case f.Status != 0:
+		reply(w, f.Status, fmt.Sprintf(`<response status="error"><msg>%v</msg></response>`, http.StatusText(f.Status)))
+		return
+	case f.Malformed:
+		reply(w, http.StatusOK, `<response status="success"><result><uid-response>`)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		replyError(w, http.StatusBadRequest, 18, "Malformed Request")
+		return
+	}
+	if r.Form.Get("type") == "keygen" {
+		h.keygen(w, r.Form.Get("user"), r.Form.Get("password"))
+		return
+	}
+	key := r.Header.Get("X-PAN-KEY")
+	if key == "" {
+		key = r.Form.Get("key")
+	}
+	if subtle.ConstantTimeCompare([]byte(key), []byte(h.apikey)) != 1 {
+		replyError(w, http.StatusForbidden, 403, "Invalid Credential")
+		return
+	}
+	switch r.Form.Get("type") {
+	case "user-id":
+		h.userID(w, r.Form.Get("cmd"))
+	case "op":
+		h.op(w, r.Form.Get("cmd"))
+	default:
+		replyError(w, http.StatusBadRequest, 18, "Malformed Request")
+	}
+}
+
+func (h *Handler) keygen(w http.ResponseWriter, user, password string) {
+	h.lock.Lock()
+	valid := h.user != "" && user == h.user && password == h.password
+	h.lock.Unlock()
+	if !valid {
+		replyError(w, http.StatusForbidden, 403, "Invalid Credential")
+		return
+	}
+	resp := x.KeygenResponse{Status: "success"}
+	resp.Result = &struct {
+		Key string `xml:"key"`
+	}{h.apikey}
+	replyXML(w, resp)
+}
+
+// userID applies the uid-message to the monitor. Entries are checked against the state of the monitor
+// to generate the same per-entry messages a device would
+func (h *Handler) userID(w http.ResponseWriter, cmd string) {
+	u := &x.UIDMessage{}
+	if err := xml.Unmarshal([]byte(cmd), u); err != nil || u.Payload == nil {
+		replyError(w, http.StatusOK, 18, "Malformed Request")
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	uidResp := &x.UIDResponse{Version: "2.0"}
+	p := u.Payload
+	tags := map[string]bool{}
+	for _, e := range h.monitor.IPTags() {
+		tags[e.IP+" "+e.Tag] = true
+	}
+	groups := map[string]bool{}
+	for _, e := range h.monitor.UserGroups() {
+		groups[e.User+" "+e.Group] = true
+	}
+	var failed bool
+	if p.Unregister != nil {
+		var entries []x.UIDResponseEntry
+		for _, e := range p.Unregister.Entry {
+			for _, t := range e.Tag.Member {
+				if k := e.IP + " " + t.Member; tags[k] {
+					delete(tags, k)
+				} else {
+					entries = append(entries, x.UIDResponseEntry{IP: e.IP, Msg: "tag " + t.Member + " does not exist, ignore unreg"})
+				}
+			}
+		}
+		if len(entries) > 0 {
+			uidResp.Payload.Unregister = &struct {
+				Entry []x.UIDResponseEntry `xml:"entry"`
+			}{entries}
+			failed = true
+		}
+	}
+	if p.UnregisterUser != nil {
+		var entries []x.UIDResponseEntry
+		for _, e := range p.UnregisterUser.Entry {
+			for _, t := range e.Tag.Member {
+				if k := e.User + " " + t.Member; groups[k] {
+					delete(groups, k)
+				} else {
+					entries = append(entries, x.UIDResponseEntry{User: e.User, Msg: "tag " + t.Member + " does not exist, ignore unreg"})
+				}
+			}
+		}
+		if len(entries) > 0 {
+			uidResp.Payload.UnregisterUser = &struct {
+				Entry []x.UIDResponseEntry `xml:"entry"`
+			}{entries}
+			failed = true
+		}
+	}
+	if p.RegisterUser != nil {
+		var entries []x.UIDResponseEntry
+		for _, e := range p.RegisterUser.Entry {
+			for _, t := range e.Tag.Member {
+				if k := e.User + " " + t.Member; groups[k] {
+					entries = append(entries, x.UIDResponseEntry{User: e.User, Msg: "tag " + t.Member + " already exists, ignore"})
+				} else {
+					groups[k] = true
+				}
+			}
+		}
+		if len(entries) > 0 {
+			uidResp.Payload.RegisterUser = &struct {
+				Entry []x.UIDResponseEntry `xml:"entry"`
+			}{entries}
+			failed = true
+		}
+	}
+	if p.Register != nil {
+		var entries []x.UIDResponseEntry
+		for _, e := range p.Register.Entry {
+			for _, t := range e.Tag.Member {
+				if k := e.IP + " " + t.Member; tags[k] {
+					entries = append(entries, x.UIDResponseEntry{IP: e.IP, Msg: "tag " + t.Member + " already exists, ignore"})
+				} else {
+					tags[k] = true
+				}
+			}
+		}
+		if len(entries) > 0 {
+			uidResp.Payload.Register = &struct {
+				Entry []x.UIDResponseEntry `xml:"entry"`
+			}{entries}
+			failed = true
+		}
+	}
+	// invalid entries are dropped by the device
+	uid.NewBuilderFromPayload(p).Lenient().Payload(h.monitor)
+	resp := x.APIResponse{Status: "success"}
+	if failed {
+		resp.Status = "error"
+		resp.Msg = &x.APIResponseMsg{Line: []x.APIResponseLine{{UidResponse: uidResp}}}
+	} else {
+		resp.Result = &struct {
+			UidResponse *x.UIDResponse    `xml:"uid-response"`
+			Msg         *x.APIResponseMsg `xml:"msg,omitempty"`
+		}{UidResponse: uidResp}
+	}
+	replyXML(w, resp)
+}
+
+// op implements the "show" operational commands used by the uid package queries
+func (h *Handler) op(w http.ResponseWriter, cmd string) {
+	switch {
+	case strings.Contains(cmd, "<registered-ip>"):
+		result := &x.RegisteredIPResult{}
+		idx := map[string]int{}
+		for _, e := range h.monitor.IPTags() {
+			persistent := "0"
+			if e.Persistent {
+				persistent = "1"
+			}
+			k := e.IP + " " + persistent
+			pos, exists := idx[k]
+			if !exists {
+				pos = len(result.Entry)
+				idx[k] = pos
+				result.Entry = append(result.Entry, x.RegisteredIPEntry{IP: e.IP, FromAgent: "0", Persistent: persistent})
+			}
+			result.Entry[pos].Tag.Member = append(result.Entry[pos].Tag.Member, tagMember(e.Tag, e.Tout))
+		}
+		result.Count = len(result.Entry)
+		replyXML(w, x.RegisteredIPResponse{Status: "success", Result: result})
+	case strings.Contains(cmd, "<ip-user-mapping>"):
+		result := &x.IPUserMappingResult{}
+		for _, e := range h.monitor.UserMaps() {
+			tout := "Never"
+			if e.Tout != nil {
+				tout = strconv.FormatUint(uint64(*e.Tout)*60, 10)
+			}
+			result.Entry = append(result.Entry, x.IPUserMappingEntry{
+				IP:          e.IP,
+				Vsys:        "vsys1",
+				Type:        "XMLAPI",
+				User:        e.User,
+				IdleTimeout: tout,
+				Timeout:     tout,
+				MaxTimeout:  tout,
+			})
+		}
+		result.Count = len(result.Entry)
+		replyXML(w, x.IPUserMappingResponse{Status: "success", Result: result})
+	case strings.Contains(cmd, "<registered-user>"):
+		result := &x.RegisteredUserResult{}
+		idx := map[string]int{}
+		for _, e := range h.monitor.UserGroups() {
+			pos, exists := idx[e.User]
+			if !exists {
+				pos = len(result.Entry)
+				idx[e.User] = pos
+				result.Entry = append(result.Entry, x.RegisteredUserEntry{User: e.User})
+			}
+			result.Entry[pos].Tag.Member = append(result.Entry[pos].Tag.Member, tagMember(e.Group, e.Tout))
+		}
+		result.Count = len(result.Entry)
+		replyXML(w, x.RegisteredUserResponse{Status: "success", Result: result})
+	default:
+		replyError(w, http.StatusOK, 17, "Invalid command")
+	}
+}
+
+// tagMember returns a registered-ip / registered-user tag with its timeout (seconds) if it has one
+func tagMember(tag string, tout *uint) (m x.UIDMsgPldDxGEnrtryTagMember) {
+	m.Member = tag
+	if tout != nil {
+		t := strconv.FormatUint(uint64(*tout), 10)
+		m.Timeout = &t
+	}
+	return
+}
+
+func reply(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/xml; charset=UTF-8")
+	w.WriteHeader(status)
+	fmt.Fprint(w, body)
+}
+
+func replyXML(w http.ResponseWriter, v interface{}) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		replyError(w, http.StatusInternalServerError, 0, err.Error())
+		return
+	}
+	reply(w, http.StatusOK, string(body))
+}
+
+func replyError(w http.ResponseWriter, status, code int, msg string) {
+	resp := x.APIResponse{Status: "error", Code: strconv.Itoa(code), Msg: &x.APIResponseMsg{Text: msg}}
+	if body, err := xml.Marshal(resp); err == nil {
+		reply(w, status, string(body))
+	} else {
+		reply(w, http.StatusInternalServerError, "")
+	}
+}
@@ -0,0 +1,125 @@
+package panostest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xhoms/panoslib/panostest"
+	"github.com/xhoms/panoslib/uid"
+	"github.com/xhoms/panoslib/uidmonitor"
+)
+
+func newServer() (h *panostest.Handler, srv *httptest.Server) {
+	h = panostest.NewHandler(uidmonitor.NewMemMonitor(), "apikey")
+	srv = httptest.NewTLSServer(h)
+	return
+}
+
+func TestHandlerUserID(t *testing.T) {
+	h, srv := newServer()
+	defer srv.Close()
+	hostport := srv.Listener.Addr().String()
+	var tout, tagTout uint = 60, 300
+	mp := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", &tagTout).
+		RegisterIPPersistent("1.1.1.2", "bar", nil).
+		LoginUser("foo@test.local", "1.1.1.1", &tout).
+		GroupUser("foo@test.local", "admin", nil)
+	_, err := uid.Validate(mp.Push(hostport, "apikey", srv.Client(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Monitor().TagIP("foo")) != 1 || len(h.Monitor().UserIP("foo@test.local")) != 1 {
+		t.Fatal("message not applied to the monitor")
+	}
+	var s *uid.Snapshot
+	if s, err = uid.QueryState(hostport, "apikey", srv.Client()); err == nil {
+		if len(s.IPTag) == 2 && len(s.UserMap) == 1 && len(s.UserGroup) == 1 &&
+			s.UserMap[0].User == "foo@test.local" && s.UserGroup[0].Group == "admin" {
+			// timeouts survive the round trip (seconds for tags, minutes for user mappings)
+			for _, e := range s.IPTag {
+				if (e.Tag == "foo") != (e.Tout != nil && *e.Tout == tagTout) {
+					t.Errorf("unexpected ip-to-tag timeout %+v", e)
+				}
+			}
+			if s.UserMap[0].Tout == nil || *s.UserMap[0].Tout != tout || s.UserGroup[0].Tout != nil {
+				t.Errorf("unexpected timeouts %+v %+v", s.UserMap[0], s.UserGroup[0])
+			}
+			return
+		}
+		err = fmt.Errorf("unexpected snapshot %+v", s)
+	}
+	t.Error(err)
+}
+
+func TestHandlerPartial(t *testing.T) {
+	_, srv := newServer()
+	defer srv.Close()
+	hostport := srv.Listener.Addr().String()
+	mp := uid.NewUIDBuilder().RegisterIP("1.1.1.1", "foo", nil)
+	if _, err := uid.Validate(mp.Push(hostport, "apikey", srv.Client(), nil)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := uid.Validate(mp.UnregisterIP("2.2.2.2", "bar").Push(hostport, "apikey", srv.Client(), nil))
+	var perr *uid.PartialError
+	if errors.As(err, &perr) {
+		if len(perr.Entries) == 2 &&
+			perr.Entries[0].Kind == uid.KindNotExist && perr.Entries[0].Value == "bar" &&
+			perr.Entries[1].Kind == uid.KindAlreadyExists && perr.Entries[1].Subject == "1.1.1.1" {
+			return
+		}
+		err = fmt.Errorf("unexpected entries %+v", perr.Entries)
+	}
+	t.Error(err)
+}
+
+func TestHandlerAuth(t *testing.T) {
+	h, srv := newServer()
+	defer srv.Close()
+	hostport := srv.Listener.Addr().String()
+	mp := uid.NewUIDBuilder().RegisterIP("1.1.1.1", "foo", nil)
+	_, err := uid.Validate(mp.Push(hostport, "wrong", srv.Client(), nil))
+	var aerr *uid.APIError
+	if !errors.As(err, &aerr) || !aerr.IsAuth() {
+		t.Fatalf("expected an authentication error, got %v", err)
+	}
+	target := uid.Target{HostPort: hostport, APIKey: "apikey", KeyHeader: true}
+	if _, err = uid.Validate(mp.PushTarget(context.Background(), target, srv.Client(), nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	h.Credentials("admin", "secret")
+	s := uid.NewSession(hostport, "admin", "secret", srv.Client())
+	if _, err = s.Push(context.Background(), uid.NewUIDBuilder().RegisterIP("1.1.1.1", "bar", nil), nil, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandlerFault(t *testing.T) {
+	h, srv := newServer()
+	defer srv.Close()
+	hostport := srv.Listener.Addr().String()
+	mp := uid.NewUIDBuilder().RegisterIP("1.1.1.1", "foo", nil)
+	h.Inject(panostest.Fault{Status: 503, Count: 2})
+	policy := uid.NewRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	if _, err := uid.Validate(mp.PushContext(context.Background(), hostport, "apikey", srv.Client(), nil, policy)); err != nil {
+		t.Fatal(err)
+	}
+	if h.Requests() != 3 {
+		t.Fatalf("expected 3 requests, got %v", h.Requests())
+	}
+	h.Inject(panostest.Fault{Malformed: true})
+	if _, err := uid.Validate(mp.Push(hostport, "apikey", srv.Client(), nil)); err == nil {
+		t.Fatal("expected an error for a malformed response")
+	}
+	h.Inject(panostest.Fault{Latency: 500 * time.Millisecond})
+	policy.MaxAttempts, policy.AttemptTimeout = 1, 50*time.Millisecond
+	_, err := uid.Validate(mp.PushContext(context.Background(), hostport, "apikey", srv.Client(), nil, policy))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package uid
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	x "github.com/xhoms/panoslib/collection"
+)
+
+// APIError is returned by Validate() for PAN-OS XML API error responses (non 200 HTTP status code or non
+// "success" status without per-entry results)
+type APIError struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// Status is the status attribute of the response (if it could be parsed)
+	Status string
+	// Code is the PAN-OS error code (zero if not present)
+	Code int
+	// Message is the text of the response msg (lines are joined with "; ")
+	Message string
+}
+
+func (e *APIError) Error() string {
+	var prefix string
+	if e.StatusCode != http.StatusOK {
+		prefix = fmt.Sprintf("replied with status code '%v'", e.StatusCode)
+	} else {
+		prefix = fmt.Sprintf("returned a non-sucess response (status: '%v')", e.Status)
+	}
+	switch {
+	case e.Code != 0 && e.Message != "":
+		return fmt.Sprintf("%v code %v: %v", prefix, e.Code, e.Message)
+	case e.Code != 0:
+		return fmt.Sprintf("%v code %v", prefix, e.Code)
+	case e.Message != "":
+		return fmt.Sprintf("%v: %v", prefix, e.Message)
+	}
+	return prefix
+}
+
+// IsAuth returns true for authentication and authorization failures (i.e. invalid API key)
+func (e *APIError) IsAuth() bool {
+	switch e.Code {
+	case 403, 16, 22:
+		return true
+	}
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// IsInput returns true for errors caused by the request (bad parameters, malformed or invalid command, etc.)
+func (e *APIError) IsInput() bool {
+	switch e.Code {
+	case 400, 1, 6, 7, 8, 10, 12, 14, 15, 17, 18:
+		return true
+	}
+	return e.StatusCode == http.StatusBadRequest
+}
+
+// IsServer returns true for internal errors of the device
+func (e *APIError) IsServer() bool {
+	switch e.Code {
+	case 2, 3, 4, 5, 11, 13, 21:
+		return true
+	}
+	return e.StatusCode >= http.StatusInternalServerError
+}
+
+func msgText(msg *x.APIResponseMsg) (out []string) {
+	if msg != nil {
+		if t := strings.TrimSpace(msg.Text); t != "" {
+			out = append(out, t)
+		}
+		for _, l := range msg.Line {
+			if t := strings.TrimSpace(l.Text); t != "" {
+				out = append(out, t)
+			}
+		}
+	}
+	return
+}
+
+// newAPIError builds an APIError from the HTTP status code and the (optional) parsed response
+func newAPIError(scode int, apiResp *x.APIResponse) (e *APIError) {
+	e = &APIError{StatusCode: scode}
+	if apiResp != nil {
+		e.Status = apiResp.Status
+		e.Code, _ = strconv.Atoi(apiResp.Code)
+		lines := msgText(apiResp.Msg)
+		if apiResp.Result != nil {
+			lines = append(lines, msgText(apiResp.Result.Msg)...)
+		}
+		e.Message = strings.Join(lines, "; ")
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package uid_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/xhoms/panoslib/uid"
+)
+
+func response(status int, body string) *http.Response {
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		StatusCode: status,
+	}
+}
+
+func TestAPIErrorAuth(t *testing.T) {
+	_, err := uid.Validate(response(http.StatusForbidden,
+		`<response status="error" code="403"><result><msg>Invalid credentials.</msg></result></response>`), nil)
+	var aerr *uid.APIError
+	if !errors.As(err, &aerr) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if aerr.Code != 403 || aerr.Message != "Invalid credentials." || !aerr.IsAuth() || aerr.IsInput() || aerr.IsServer() {
+		t.Errorf("unexpected error details %+v", aerr)
+	}
+}
+
+func TestAPIErrorInput(t *testing.T) {
+	_, err := uid.Validate(response(http.StatusOK,
+		`<response status="error" code="18"><msg><line><![CDATA[malformed command]]></line><line>second line</line></msg></response>`), nil)
+	var aerr *uid.APIError
+	if !errors.As(err, &aerr) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if aerr.Code != 18 || aerr.Message != "malformed command; second line" || !aerr.IsInput() || aerr.IsAuth() {
+		t.Errorf("unexpected error details %+v", aerr)
+	}
+}
+
+func TestAPIErrorServer(t *testing.T) {
+	_, err := uid.Validate(response(http.StatusServiceUnavailable, `service unavailable`), nil)
+	var aerr *uid.APIError
+	if !errors.As(err, &aerr) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if aerr.StatusCode != http.StatusServiceUnavailable || !aerr.IsServer() {
+		t.Errorf("unexpected error details %+v", aerr)
+	}
+}
@@ -0,0 +1,171 @@
+package uid
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	x "github.com/xhoms/panoslib/collection"
+)
+
+// ErrBatcherClosed is returned by Batcher methods invoked after Close()
+var ErrBatcherClosed = errors.New("batcher is closed")
+
+// BatcherConfig holds the flush triggers and reporting options of a Batcher
+type BatcherConfig struct {
+	// MaxEntries triggers a flush when the number of pending entries reaches it. Values lower than 1 mean 1000
+	MaxEntries int
+	// MaxDelay triggers a flush this time after the first pending entry was added. Values lower than 1 mean 1s
+	MaxDelay time.Duration
+	// Retry is the policy applied to each push (nil means a single attempt)
+	Retry *RetryPolicy
+	// OnFlush (optional) is invoked after every push with the number of entries sent and the validated
+	// response. It is the only way to learn about errors of flushes triggered by MaxDelay
+	OnFlush func(entries int, apiResp *x.APIResponse, err error)
+}
+
+/*
+Batcher is a long-lived accumulator of User-ID entries that pushes them to a device in batches. Use an
+initialized version as provided by NewBatcher() or NewBatcherTarget().
+
+Unlike UIDBuilder, Batcher methods are goroutine safe. Entries are merged into an internal UIDBuilder and
+pushed when MaxEntries is reached (the push happens in the goroutine that added the last entry) or MaxDelay
+after the first pending entry was added (the push happens in a background goroutine). Batches are pushed
+in order, one at a time
+*/
+type Batcher struct {
+	t        Target
+	c        Client
+	m        Monitor
+	cfg      BatcherConfig
+	lock     *sync.Mutex
+	pushLock *sync.Mutex
+	pending  UIDBuilder
+	timer    *time.Timer
+	closed   bool
+}
+
+// NewBatcher returns a ready-to-consume Batcher that pushes to the device at hostport
+func NewBatcher(hostport, apikey string, c Client, m Monitor, cfg BatcherConfig) (b *Batcher) {
+	return NewBatcherTarget(Target{HostPort: hostport, APIKey: apikey}, c, m, cfg)
+}
+
+// NewBatcherTarget returns a ready-to-consume Batcher that pushes to the device described by t
+func NewBatcherTarget(t Target, c Client, m Monitor, cfg BatcherConfig) (b *Batcher) {
+	if cfg.MaxEntries < 1 {
+		cfg.MaxEntries = 1000
+	}
+	if cfg.MaxDelay < 1 {
+		cfg.MaxDelay = time.Second
+	}
+	b = &Batcher{
+		t:        t,
+		c:        c,
+		m:        m,
+		cfg:      cfg,
+		lock:     &sync.Mutex{},
+		pushLock: &sync.Mutex{},
+		pending:  NewUIDBuilder(),
+	}
+	return
+}
+
+// Add merges all entries in mpB into the batch. A builder with rejected entries (see UIDBuilder.Err()) is
+// not added and its error is returned instead. Entries rejected by a lenient builder (see
+// UIDBuilder.Lenient()) are dropped and only its valid entries are added
+func (b *Batcher) Add(mpB UIDBuilder) (err error) {
+	if err = mpB.Err(); err != nil {
+		return
+	}
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return ErrBatcherClosed
+	}
+	b.pending = b.pending.append(mpB.entries, nil)
+	full := len(b.pending.entries) >= b.cfg.MaxEntries
+	if !full && b.timer == nil && len(b.pending.entries) > 0 {
+		b.timer = time.AfterFunc(b.cfg.MaxDelay, func() { b.Flush() })
+	}
+	b.lock.Unlock()
+	if full {
+		err = b.Flush()
+	}
+	return
+}
+
+// RegisterIP adds a single ip-to-tag entry into the batch
+func (b *Batcher) RegisterIP(ip, tag string, tout *uint) error {
+	return b.Add(NewUIDBuilder().RegisterIP(ip, tag, tout))
+}
+
+// UnregisterIP adds a single ip-to-tag entry in the "unregister" section into the batch
+func (b *Batcher) UnregisterIP(ip, tag string) error {
+	return b.Add(NewUIDBuilder().UnregisterIP(ip, tag))
+}
+
+// LoginUser adds a single user-to-ip entry into the batch
+func (b *Batcher) LoginUser(user, ip string, tout *uint) error {
+	return b.Add(NewUIDBuilder().LoginUser(user, ip, tout))
+}
+
+// LogoutUser adds a single user-to-ip entry in the "logout" section into the batch
+func (b *Batcher) LogoutUser(user, ip string) error {
+	return b.Add(NewUIDBuilder().LogoutUser(user, ip))
+}
+
+// GroupUser adds a single user-to-group (DUG) entry into the batch
+func (b *Batcher) GroupUser(user, group string, tout *uint) error {
+	return b.Add(NewUIDBuilder().GroupUser(user, group, tout))
+}
+
+// UngroupUser adds a single user-to-group entry in the "unregister-user" section into the batch
+func (b *Batcher) UngroupUser(user, group string) error {
+	return b.Add(NewUIDBuilder().UngroupUser(user, group))
+}
+
+// take returns the pending batch and resets it. Must be called with lock held
+func (b *Batcher) take() (mp UIDBuilder) {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	mp, b.pending = b.pending, NewUIDBuilder()
+	return
+}
+
+// Flush pushes all pending entries (if any) and returns the validation error of the push
+func (b *Batcher) Flush() (err error) {
+	b.pushLock.Lock()
+	defer b.pushLock.Unlock()
+	b.lock.Lock()
+	mp := b.take()
+	b.lock.Unlock()
+	return b.push(mp)
+}
+
+// Close flushes all pending entries and rejects further ones
+func (b *Batcher) Close() (err error) {
+	b.pushLock.Lock()
+	defer b.pushLock.Unlock()
+	b.lock.Lock()
+	b.closed = true
+	mp := b.take()
+	b.lock.Unlock()
+	return b.push(mp)
+}
+
+func (b *Batcher) push(mp UIDBuilder) (err error) {
+	size := len(mp.entries)
+	if size == 0 && mp.err == nil {
+		return
+	}
+	var apiResp *x.APIResponse
+	apiResp, err = Validate(mp.PushTarget(context.Background(), b.t, b.c, b.m, b.cfg.Retry))
+	err = Redact(err, b.t.APIKey)
+	if b.cfg.OnFlush != nil {
+		b.cfg.OnFlush(size, apiResp, err)
+	}
+	return
+}
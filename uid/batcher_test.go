@@ -0,0 +1,143 @@
+package uid_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	x "github.com/xhoms/panoslib/collection"
+	"github.com/xhoms/panoslib/uid"
+)
+
+// syncClient is a goroutine safe client that records the uid-message of every request
+type syncClient struct {
+	lock sync.Mutex
+	msgs []string
+}
+
+func (c *syncClient) Do(req *http.Request) (resp *http.Response, err error) {
+	if err = req.ParseForm(); err == nil {
+		c.lock.Lock()
+		c.msgs = append(c.msgs, req.PostForm.Get("cmd"))
+		c.lock.Unlock()
+		resp = &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(successBody))),
+			StatusCode: http.StatusOK,
+		}
+	}
+	return
+}
+
+func (c *syncClient) count() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.msgs)
+}
+
+func TestBatcherMaxEntries(t *testing.T) {
+	c := &syncClient{}
+	var lock sync.Mutex
+	flushed := 0
+	b := uid.NewBatcher("vm.test.local", "apikey", c, nil, uid.BatcherConfig{
+		MaxEntries: 10,
+		MaxDelay:   time.Hour,
+		OnFlush: func(entries int, apiResp *x.APIResponse, err error) {
+			lock.Lock()
+			flushed += entries
+			lock.Unlock()
+		},
+	})
+	wg := sync.WaitGroup{}
+	for g := 0; g < 5; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for idx := 0; idx < 10; idx++ {
+				b.RegisterIP(fmt.Sprintf("10.0.%v.%v", g, idx), "foo", nil)
+			}
+		}(g)
+	}
+	wg.Wait()
+	var err error
+	if err = b.Close(); err == nil {
+		switch {
+		case flushed != 50:
+			err = fmt.Errorf("expected 50 entries flushed, got %v", flushed)
+		case !errors.Is(b.LoginUser("foo@test.local", "1.1.1.1", nil), uid.ErrBatcherClosed):
+			err = errors.New("batcher accepted entries after Close()")
+		default:
+			return
+		}
+	}
+	t.Error(err)
+}
+
+func TestBatcherSequential(t *testing.T) {
+	c := &syncClient{}
+	b := uid.NewBatcher("vm.test.local", "apikey", c, nil, uid.BatcherConfig{MaxEntries: 10, MaxDelay: time.Hour})
+	for idx := 0; idx < 25; idx++ {
+		b.RegisterIP(fmt.Sprintf("10.0.0.%v", idx), "foo", nil)
+	}
+	if c.count() != 2 {
+		t.Errorf("expected 2 pushes before Close(), got %v", c.count())
+	}
+	if err := b.Close(); err != nil || c.count() != 3 {
+		t.Errorf("expected 3 pushes after Close(), got %v", c.count())
+	}
+}
+
+func TestBatcherMaxDelay(t *testing.T) {
+	c := &syncClient{}
+	done := make(chan int, 1)
+	b := uid.NewBatcher("vm.test.local", "apikey", c, nil, uid.BatcherConfig{
+		MaxEntries: 100,
+		MaxDelay:   10 * time.Millisecond,
+		OnFlush: func(entries int, apiResp *x.APIResponse, err error) {
+			done <- entries
+		},
+	})
+	defer b.Close()
+	b.LoginUser("foo@test.local", "1.1.1.1", nil)
+	b.GroupUser("foo@test.local", "admin", nil)
+	select {
+	case entries := <-done:
+		if entries != 2 || c.count() != 1 {
+			t.Errorf("unexpected flush (%v entries, %v pushes)", entries, c.count())
+		}
+	case <-time.After(time.Second):
+		t.Error("batch not flushed after MaxDelay")
+	}
+}
+
+func TestBatcherFlush(t *testing.T) {
+	c := &syncClient{}
+	b := uid.NewBatcher("vm.test.local", "apikey", c, nil, uid.BatcherConfig{MaxDelay: time.Hour})
+	b.RegisterIP("1.1.1.1", "foo", nil)
+	b.UnregisterIP("1.1.1.1", "bar")
+	if err := b.Flush(); err != nil || c.count() != 1 {
+		t.Error("expected a single push")
+	}
+	if err := b.Flush(); err != nil || c.count() != 1 {
+		t.Error("empty flush must not push")
+	}
+}
+
+func TestBatcherLenient(t *testing.T) {
+	c := &syncClient{}
+	b := uid.NewBatcher("vm.test.local", "apikey", c, nil, uid.BatcherConfig{MaxDelay: time.Hour})
+	if err := b.Add(uid.NewUIDBuilder().RegisterIP("bad", "foo", nil).RegisterIP("1.1.1.1", "foo", nil).Lenient()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Flush(); err != nil || c.count() != 1 {
+		t.Fatalf("expected a single push (err %v, %v pushes)", err, c.count())
+	}
+	if msg := c.msgs[0]; !strings.Contains(msg, "1.1.1.1") || strings.Contains(msg, "bad") {
+		t.Errorf("unexpected message %v", msg)
+	}
+}
@@ -0,0 +1,293 @@
+package uid
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	x "github.com/xhoms/panoslib/collection"
+)
+
+type countWriter int
+
+func (cw *countWriter) Write(p []byte) (n int, err error) {
+	n = len(p)
+	*cw += countWriter(n)
+	return
+}
+
+// encodedLen returns the number of bytes v takes once xml encoded as an element named name
+func encodedLen(v interface{}, name string) (n int, err error) {
+	var cw countWriter
+	enc := xml.NewEncoder(&cw)
+	if err = enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}}); err == nil {
+		if err = enc.Flush(); err == nil {
+			n = int(cw)
+		}
+	}
+	return
+}
+
+// chunker splits a payload into a sequence of messages bounded by entry count and encoded size. The size
+// of a chunk is computed as the sum of its individual entries so it is an upper bound of the real size
+// (consecutive entries for the same subject are merged together)
+type chunker struct {
+	maxEntries, maxBytes int
+	overhead             int
+	msgs                 []*x.UIDMessage
+	cur                  *x.UIDMsgPayload
+	open                 map[string]bool
+	count, size          int
+}
+
+func newChunker(maxEntries, maxBytes int) (c *chunker, err error) {
+	var overhead int
+	empty := &x.UIDMessage{Type: "update", Version: "2.0", Payload: &x.UIDMsgPayload{}}
+	if overhead, err = encodedLen(empty, "uid-message"); err == nil {
+		c = &chunker{
+			maxEntries: maxEntries,
+			maxBytes:   maxBytes,
+			overhead:   overhead,
+			msgs:       []*x.UIDMessage{},
+		}
+	}
+	return
+}
+
+// reserve makes room for an entry of n bytes in the section provided, opening a new chunk if needed
+func (c *chunker) reserve(section string, n int) (err error) {
+	wrapper := 2*len(section) + 5
+	extra := n
+	if !c.open[section] {
+		extra += wrapper
+	}
+	if c.cur != nil &&
+		((c.maxEntries > 0 && c.count >= c.maxEntries) ||
+			(c.maxBytes > 0 && c.size+extra > c.maxBytes)) {
+		c.cur = nil
+	}
+	if c.cur == nil {
+		c.cur = &x.UIDMsgPayload{}
+		c.msgs = append(c.msgs, &x.UIDMessage{Type: "update", Version: "2.0", Payload: c.cur})
+		c.open = map[string]bool{}
+		c.count, c.size = 0, c.overhead
+		extra = n + wrapper
+		if c.maxBytes > 0 && c.size+extra > c.maxBytes {
+			err = fmt.Errorf("%v entry of %v bytes does not fit in a %v bytes message", section, n, c.maxBytes)
+			return
+		}
+	}
+	c.open[section] = true
+	c.count++
+	c.size += extra
+	return
+}
+
+func (c *chunker) dag(section string, src *x.UIDMsgPldDAGRegUnreg, sel func(*x.UIDMsgPayload) **x.UIDMsgPldDAGRegUnreg) (err error) {
+	if src == nil {
+		return
+	}
+	for _, e := range src.Entry {
+		for _, member := range e.Tag.Member {
+			unit := x.UIDMsgPldDAGEntry{
+				IP:         e.IP,
+				Persistent: e.Persistent,
+				Tag:        x.UIDMsgPldDxGEntryTag{Member: []x.UIDMsgPldDxGEnrtryTagMember{member}},
+			}
+			var n int
+			if n, err = encodedLen(unit, "entry"); err != nil {
+				return
+			}
+			if err = c.reserve(section, n); err != nil {
+				return
+			}
+			dst := sel(c.cur)
+			if *dst == nil {
+				*dst = &x.UIDMsgPldDAGRegUnreg{}
+			}
+			if last := len((*dst).Entry) - 1; last >= 0 &&
+				(*dst).Entry[last].IP == e.IP &&
+				(*dst).Entry[last].Persistent == e.Persistent {
+				(*dst).Entry[last].Tag.Member = append((*dst).Entry[last].Tag.Member, member)
+			} else {
+				(*dst).Entry = append((*dst).Entry, unit)
+			}
+		}
+	}
+	return
+}
+
+func (c *chunker) dug(section string, src *x.UIDMsgPldDUGRegUnreg, sel func(*x.UIDMsgPayload) **x.UIDMsgPldDUGRegUnreg) (err error) {
+	if src == nil {
+		return
+	}
+	for _, e := range src.Entry {
+		for _, member := range e.Tag.Member {
+			unit := x.UIDMsgPldDUGEntry{
+				User: e.User,
+				Tag:  x.UIDMsgPldDxGEntryTag{Member: []x.UIDMsgPldDxGEnrtryTagMember{member}},
+			}
+			var n int
+			if n, err = encodedLen(unit, "entry"); err != nil {
+				return
+			}
+			if err = c.reserve(section, n); err != nil {
+				return
+			}
+			dst := sel(c.cur)
+			if *dst == nil {
+				*dst = &x.UIDMsgPldDUGRegUnreg{}
+			}
+			if last := len((*dst).Entry) - 1; last >= 0 && (*dst).Entry[last].User == e.User {
+				(*dst).Entry[last].Tag.Member = append((*dst).Entry[last].Tag.Member, member)
+			} else {
+				(*dst).Entry = append((*dst).Entry, unit)
+			}
+		}
+	}
+	return
+}
+
+func (c *chunker) groups(section string, src *x.UIDMsgPldGroups, sel func(*x.UIDMsgPayload) **x.UIDMsgPldGroups) (err error) {
+	if src == nil {
+		return
+	}
+	for _, e := range src.Entry {
+		var n int
+		if n, err = encodedLen(e, "entry"); err != nil {
+			return
+		}
+		if err = c.reserve(section, n); err != nil {
+			return
+		}
+		dst := sel(c.cur)
+		if *dst == nil {
+			*dst = &x.UIDMsgPldGroups{}
+		}
+		(*dst).Entry = append((*dst).Entry, e)
+	}
+	return
+}
+
+func (c *chunker) log(section string, src *x.UIDMsgPldLogInOut, sel func(*x.UIDMsgPayload) **x.UIDMsgPldLogInOut) (err error) {
+	if src == nil {
+		return
+	}
+	for _, e := range src.Entry {
+		var n int
+		if n, err = encodedLen(e, "entry"); err != nil {
+			return
+		}
+		if err = c.reserve(section, n); err != nil {
+			return
+		}
+		dst := sel(c.cur)
+		if *dst == nil {
+			*dst = &x.UIDMsgPldLogInOut{}
+		}
+		(*dst).Entry = append((*dst).Entry, e)
+	}
+	return
+}
+
+/*
+Messages is a final action. It merges all accumulated data into a list of ready-to use PAN-OS XML
+User-ID API messages. Every message will contain, at most, maxEntries entries (an entry being a single
+ip-to-tag, user-to-group or user-to-ip item) and will take, at most, maxBytes once xml encoded. A zero
+or negative value disables the corresponding limit. An error is returned if a single entry does not fit
+in maxBytes.
+
+Entries are distributed in the order unregister > unregister-user > logout > login > groups > register-user >
+register so sending the messages sequentially has the same effect than sending the whole payload at once. The
+member list of a group is never split (it counts as a single entry). An empty builder returns an empty list.
+
+If a variable implementing the Monitor interface is provided then a log entry
+will be issued to it for every entry in the payload. Order of log entries will
+be unregister > unregister-user > logout > login > groups > register-user > register
+*/
+func (mp UIDBuilder) Messages(maxEntries, maxBytes int, m Monitor) (u []*x.UIDMessage, err error) {
+	var p *x.UIDMsgPayload
+	if p, err = mp.Payload(m); err != nil {
+		return
+	}
+	var c *chunker
+	if c, err = newChunker(maxEntries, maxBytes); err != nil {
+		return
+	}
+	steps := []func() error{
+		func() error {
+			return c.dag("unregister", p.Unregister, func(p *x.UIDMsgPayload) **x.UIDMsgPldDAGRegUnreg { return &p.Unregister })
+		},
+		func() error {
+			return c.dug("unregister-user", p.UnregisterUser, func(p *x.UIDMsgPayload) **x.UIDMsgPldDUGRegUnreg { return &p.UnregisterUser })
+		},
+		func() error {
+			return c.log("logout", p.Logout, func(p *x.UIDMsgPayload) **x.UIDMsgPldLogInOut { return &p.Logout })
+		},
+		func() error {
+			return c.log("login", p.Login, func(p *x.UIDMsgPayload) **x.UIDMsgPldLogInOut { return &p.Login })
+		},
+		func() error {
+			return c.groups("groups", p.Groups, func(p *x.UIDMsgPayload) **x.UIDMsgPldGroups { return &p.Groups })
+		},
+		func() error {
+			return c.dug("register-user", p.RegisterUser, func(p *x.UIDMsgPayload) **x.UIDMsgPldDUGRegUnreg { return &p.RegisterUser })
+		},
+		func() error {
+			return c.dag("register", p.Register, func(p *x.UIDMsgPayload) **x.UIDMsgPldDAGRegUnreg { return &p.Register })
+		},
+	}
+	for _, step := range steps {
+		if err = step(); err != nil {
+			return
+		}
+	}
+	u = c.msgs
+	return
+}
+
+/*
+PushMessages is a final action. It splits all accumulated data into a list of messages (see Messages())
+and sends them sequentially to the device leveraging a provided http.Client. Every response is checked
+with Validate() and the process stops at the first failure. The list of responses received so far is
+returned in any case.
+
+If a variable implementing the Monitor interface is provided then a log entry
+will be issued to it for every entry in the payload. Order of log entries will
+be unregister > unregister-user > logout > login > groups > register-user > register
+*/
+func (mp UIDBuilder) PushMessages(
+	hostport, apikey string,
+	maxEntries, maxBytes int,
+	c Client,
+	m Monitor) (apiResp []*x.APIResponse, err error) {
+	return mp.PushMessagesTarget(Target{HostPort: hostport, APIKey: apikey}, maxEntries, maxBytes, c, m)
+}
+
+/*
+PushMessagesTarget is a final action. It behaves like PushMessages() but the destination
+is described by a Target.
+
+If a variable implementing the Monitor interface is provided then a log entry
+will be issued to it for every entry in the payload. Order of log entries will
+be unregister > unregister-user > logout > login > groups > register-user > register
+*/
+func (mp UIDBuilder) PushMessagesTarget(
+	t Target,
+	maxEntries, maxBytes int,
+	c Client,
+	m Monitor) (apiResp []*x.APIResponse, err error) {
+	var u []*x.UIDMessage
+	if u, err = mp.Messages(maxEntries, maxBytes, m); err != nil {
+		return
+	}
+	apiResp = make([]*x.APIResponse, 0, len(u))
+	for idx, msg := range u {
+		var r *x.APIResponse
+		if r, err = Validate(push(t, msg, c)); err != nil {
+			err = fmt.Errorf("message %v of %v: %v", idx+1, len(u), Redact(err, t.APIKey))
+			return
+		}
+		apiResp = append(apiResp, r)
+	}
+	return
+}
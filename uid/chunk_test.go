@@ -0,0 +1,150 @@
+package uid_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	x "github.com/xhoms/panoslib/collection"
+	"github.com/xhoms/panoslib/uid"
+)
+
+func bigBuilder(n int) (mp uid.UIDBuilder) {
+	var tout uint = 60
+	mp = uid.NewUIDBuilder()
+	for idx := 0; idx < n; idx++ {
+		ip := fmt.Sprintf("10.0.%v.%v", idx/250, idx%250)
+		mp = mp.
+			UnregisterIP(ip, "old").
+			RegisterIP(ip, "new", &tout).
+			LoginUser(fmt.Sprintf("user%v@test.local", idx), ip, &tout)
+	}
+	return
+}
+
+func countMessages(u []*x.UIDMessage) (unreg, reg, login int) {
+	for _, msg := range u {
+		if msg.Payload.Unregister != nil {
+			for _, e := range msg.Payload.Unregister.Entry {
+				unreg += len(e.Tag.Member)
+			}
+		}
+		if msg.Payload.Register != nil {
+			for _, e := range msg.Payload.Register.Entry {
+				reg += len(e.Tag.Member)
+			}
+		}
+		if msg.Payload.Login != nil {
+			login += len(msg.Payload.Login.Entry)
+		}
+	}
+	return
+}
+
+func TestMessagesMaxEntries(t *testing.T) {
+	var err error
+	var u []*x.UIDMessage
+	if u, err = bigBuilder(100).Messages(40, 0, nil); err == nil {
+		unreg, reg, login := countMessages(u)
+		switch {
+		case len(u) != 8:
+			err = fmt.Errorf("expected 8 messages, got %v", len(u))
+		case unreg != 100, reg != 100, login != 100:
+			err = errors.New("recovery error")
+		default:
+			return
+		}
+	}
+	t.Error(err)
+}
+
+func TestMessagesMaxBytes(t *testing.T) {
+	var err error
+	var u []*x.UIDMessage
+	maxBytes := 2048
+	if u, err = bigBuilder(100).Messages(0, maxBytes, nil); err == nil {
+		for _, msg := range u {
+			var b []byte
+			if b, err = xml.Marshal(msg); err != nil {
+				break
+			}
+			if len(b) > maxBytes {
+				err = fmt.Errorf("message of %v bytes exceeds limit", len(b))
+				break
+			}
+		}
+		if err == nil {
+			if unreg, reg, login := countMessages(u); len(u) > 1 && unreg == 100 && reg == 100 && login == 100 {
+				return
+			}
+			err = errors.New("recovery error")
+		}
+	}
+	t.Error(err)
+}
+
+func TestMessagesTooSmall(t *testing.T) {
+	if _, err := bigBuilder(1).Messages(0, 100, nil); err == nil {
+		t.Error("expected error for an entry larger than maxBytes")
+	}
+}
+
+func TestMessagesEmpty(t *testing.T) {
+	if u, err := uid.NewUIDBuilder().Messages(10, 0, nil); err != nil || len(u) != 0 {
+		t.Error("expected an empty list of messages")
+	}
+}
+
+type countClient struct {
+	body  string
+	count int
+}
+
+func (c *countClient) Do(req *http.Request) (resp *http.Response, err error) {
+	c.count++
+	resp = &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(c.body))),
+		StatusCode: http.StatusOK,
+	}
+	return
+}
+
+func TestPushMessages(t *testing.T) {
+	c := &countClient{body: `<response status="success"><result><uid-response><version>2.0</version></uid-response></result></response>`}
+	var err error
+	var apiResp []*x.APIResponse
+	if apiResp, err = bigBuilder(25).PushMessages("vm.test.local", "apikey", 10, 0, c, nil); err == nil {
+		if len(apiResp) == 8 && c.count == 8 {
+			return
+		}
+		err = fmt.Errorf("unexpected number of requests (%v)", c.count)
+	}
+	t.Error(err)
+}
+
+func TestPushMessagesErr(t *testing.T) {
+	c := &countClient{body: `<response status="error"><msg><line>failure</line></msg></response>`}
+	if apiResp, err := bigBuilder(25).PushMessages("vm.test.local", "apikey", 10, 0, c, nil); err == nil ||
+		len(apiResp) != 0 || c.count != 1 {
+		t.Error("expected push to stop at the first failure")
+	}
+}
+
+func TestMessagesGroups(t *testing.T) {
+	var err error
+	var u []*x.UIDMessage
+	if u, err = uid.NewUIDBuilder().
+		SetGroupMembers("admin", []string{"foo@test.local", "bar@test.local"}).
+		SetGroupMembers("devops", []string{"bar@test.local"}).
+		Messages(1, 0, nil); err == nil {
+		if len(u) == 2 && u[0].Payload.Groups != nil && u[1].Payload.Groups != nil {
+			return
+		}
+		err = errors.New("recovery error")
+	}
+	t.Error(err)
+}
@@ -11,27 +11,47 @@ import (
 
 // Validate provides PAN-OS XML User-ID API response validation. Error will be raised either
 // by underlying http/net errors of because the PAN-OS User-ID response contains a non "success"
-// status code
+// status code. In the latter case, if the response contains per-entry results, the error is a
+// *PartialError listing them (see Results()). Otherwise it is an *APIError with the details of
+// the failure
 func Validate(resp *http.Response, resperr error) (apiResp *x.APIResponse, err error) {
+	_, apiResp, err = validate(resp, resperr)
+	return
+}
+
+// validate implements Validate() and returns the raw response body as well so it can be parsed again
+// into a more specific struct
+func validate(resp *http.Response, resperr error) (body []byte, apiResp *x.APIResponse, err error) {
 	if resperr != nil {
 		err = resperr
 		return
 	}
-	if scode := resp.StatusCode; scode == 200 {
-		if body, readErr := ioutil.ReadAll(resp.Body); readErr == nil {
-			apiResp = &x.APIResponse{}
-			if xmlerr := xml.Unmarshal(body, apiResp); xmlerr == nil {
-				if apiResp.Status != "success" {
-					err = fmt.Errorf("returned a non-sucess response (status: '%v')", apiResp.Status)
-				}
-			} else {
-				err = fmt.Errorf("error unmarshaling xml body")
-			}
-		} else {
+	defer resp.Body.Close()
+	var readErr error
+	if body, readErr = ioutil.ReadAll(resp.Body); readErr != nil {
+		if resp.StatusCode == http.StatusOK {
 			err = fmt.Errorf("error reading body (%v)", readErr.Error())
+		} else {
+			err = newAPIError(resp.StatusCode, nil)
+		}
+		return
+	}
+	parsed := &x.APIResponse{}
+	xmlerr := xml.Unmarshal(body, parsed)
+	if xmlerr == nil {
+		apiResp = parsed
+	}
+	switch {
+	case resp.StatusCode != http.StatusOK:
+		err = newAPIError(resp.StatusCode, apiResp)
+	case xmlerr != nil:
+		err = fmt.Errorf("error unmarshaling xml body")
+	case apiResp.Status != "success":
+		if results := Results(apiResp); len(results) > 0 {
+			err = &PartialError{Status: apiResp.Status, Entries: results}
+		} else {
+			err = newAPIError(resp.StatusCode, apiResp)
 		}
-	} else {
-		err = fmt.Errorf("replied with status code '%v'", scode)
 	}
 	return
 }
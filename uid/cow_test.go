@@ -0,0 +1,89 @@
+package uid_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xhoms/panoslib/uid"
+)
+
+func TestBranchIndependence(t *testing.T) {
+	base := uid.NewUIDBuilder()
+	for idx := 0; idx < 5; idx++ {
+		base = base.RegisterIP(fmt.Sprintf("1.1.1.%v", idx), "base", nil)
+	}
+	base = base.RegisterIP("bad-ip", "base", nil)
+	branches := make([]uid.UIDBuilder, 50)
+	for idx := range branches {
+		branches[idx] = base.
+			RegisterIP(fmt.Sprintf("2.2.2.%v", idx), "branch", nil).
+			LoginUser(fmt.Sprintf("user%v@test.local", idx), "2.2.2.2", nil).
+			UnregisterIP("bad-ip", "branch")
+	}
+	if p, err := base.Lenient().Payload(nil); err != nil || len(p.Register.Entry) != 5 || p.Login != nil || len(base.Rejected()) != 1 {
+		t.Fatalf("base builder modified by its branches (%v)", err)
+	}
+	for idx, b := range branches {
+		p, err := b.Lenient().Payload(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Register.Entry) != 6 || p.Register.Entry[5].IP != fmt.Sprintf("2.2.2.%v", idx) ||
+			len(p.Login.Entry) != 1 || p.Login.Entry[0].Name != fmt.Sprintf("user%v@test.local", idx) ||
+			len(b.Rejected()) != 2 {
+			t.Errorf("branch %v overwritten by other branches", idx)
+		}
+	}
+}
+
+func TestBranchConcurrent(t *testing.T) {
+	base := uid.NewUIDBuilder().RegisterIP("1.1.1.1", "base", nil)
+	wg := &sync.WaitGroup{}
+	errs := make([]error, 20)
+	for idx := range errs {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			b := base
+			for n := 0; n < 100; n++ {
+				b = b.RegisterIP("2.2.2.2", fmt.Sprintf("branch%v-%v", idx, n), nil)
+			}
+			p, err := b.Payload(nil)
+			if err == nil {
+				for _, e := range p.Register.Entry {
+					for _, m := range e.Tag.Member {
+						if e.IP == "2.2.2.2" && !strings.HasPrefix(m.Member, fmt.Sprintf("branch%v-", idx)) {
+							err = fmt.Errorf("branch %v contains %v", idx, m.Member)
+						}
+					}
+				}
+			}
+			errs[idx] = err
+		}(idx)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestInputCopy(t *testing.T) {
+	var tout uint = 10
+	dag := []uid.IPTag{{IP: "1.1.1.1", Tag: "foo", Tout: &tout}}
+	users := []string{"foo@test.local"}
+	mp := uid.NewUIDBuilder().Register(dag).SetGroupMembers("admin", users)
+	dag[0].IP, tout, users[0] = "2.2.2.2", 20, "bar@test.local"
+	p, err := mp.Payload(nil)
+	if err == nil {
+		if p.Register.Entry[0].IP == "1.1.1.1" && *p.Register.Entry[0].Tag.Member[0].Timeout == "10" &&
+			p.Groups.Entry[0].Members.Entry[0].Name == "foo@test.local" {
+			return
+		}
+		err = fmt.Errorf("builder changed with its inputs")
+	}
+	t.Error(err)
+}
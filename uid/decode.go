@@ -0,0 +1,186 @@
+package uid
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	x "github.com/xhoms/panoslib/collection"
+)
+
+// ErrInvalidTimeout is the reason of entries whose timeout attribute is not a valid number
+var ErrInvalidTimeout = errors.New("invalid timeout")
+
+// DecodeError locates an entry of a uid-message rejected while decoding it. Section is the payload section
+// (i.e. "register" or "login"), Entry the index of the entry in the section and Member the index of the tag
+// (register, unregister, register-user and unregister-user) or user (groups) inside the entry. Member is -1
+// for login and logout entries and for group entries rejected as a whole. Err is an EntryError with the reason
+type DecodeError struct {
+	Section       string
+	Entry, Member int
+	Err           error
+}
+
+func (e DecodeError) Error() string {
+	if e.Member < 0 {
+		return fmt.Sprintf("%v entry %v: %v", e.Section, e.Entry, e.Err)
+	}
+	return fmt.Sprintf("%v entry %v member %v: %v", e.Section, e.Entry, e.Member, e.Err)
+}
+
+func (e DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decoder accumulates the entries of a payload into a builder keeping track of the location of the rejected ones
+type decoder struct {
+	mp       UIDBuilder
+	rejected []DecodeError
+}
+
+// locate records the entries rejected by the builder since it had n of them
+func (d *decoder) locate(n int, section string, entry, member int) {
+	for _, e := range d.mp.invalid[n:] {
+		d.rejected = append(d.rejected, DecodeError{Section: section, Entry: entry, Member: member, Err: e})
+	}
+}
+
+// timeout parses the timeout attribute of an entry, rejecting it if invalid
+func (d *decoder) timeout(in *string, op Operation, subject, value, section string, entry, member int) (tout *uint, ok bool) {
+	var err error
+	if tout, err = ptrstr2uint(in); err != nil {
+		n := len(d.mp.invalid)
+		d.mp = d.mp.reject(op, subject, value, ErrInvalidTimeout)
+		d.locate(n, section, entry, member)
+		return
+	}
+	ok = true
+	return
+}
+
+func (d *decoder) payload(p *x.UIDMsgPayload) {
+	if p == nil {
+		return
+	}
+	if p.Logout != nil {
+		for idx, e := range p.Logout.Entry {
+			n := len(d.mp.invalid)
+			d.mp = d.mp.LogoutUser(e.Name, e.IP)
+			d.locate(n, "logout", idx, -1)
+		}
+	}
+	if p.Login != nil {
+		for idx, e := range p.Login.Entry {
+			if tout, ok := d.timeout(e.Timeout, Login, e.Name, e.IP, "login", idx, -1); ok {
+				n := len(d.mp.invalid)
+				d.mp = d.mp.LoginUser(e.Name, e.IP, tout)
+				d.locate(n, "login", idx, -1)
+			}
+		}
+	}
+	if p.Groups != nil {
+		for idx, e := range p.Groups.Entry {
+			users := make([]string, len(e.Members.Entry))
+			// index of the members the builder rejects (none if the whole entry is rejected)
+			members := []int{}
+			for midx, u := range e.Members.Entry {
+				users[midx] = u.Name
+				if checkGroup(e.Name) == nil && checkUser(u.Name) != nil {
+					members = append(members, midx)
+				}
+			}
+			n := len(d.mp.invalid)
+			d.mp = d.mp.SetGroupMembers(e.Name, users)
+			for pos, rej := range d.mp.invalid[n:] {
+				member := -1
+				if pos < len(members) {
+					member = members[pos]
+				}
+				d.rejected = append(d.rejected, DecodeError{Section: "groups", Entry: idx, Member: member, Err: rej})
+			}
+		}
+	}
+	if p.UnregisterUser != nil {
+		for idx, e := range p.UnregisterUser.Entry {
+			for midx, t := range e.Tag.Member {
+				n := len(d.mp.invalid)
+				d.mp = d.mp.UngroupUser(e.User, t.Member)
+				d.locate(n, "unregister-user", idx, midx)
+			}
+		}
+	}
+	if p.RegisterUser != nil {
+		for idx, e := range p.RegisterUser.Entry {
+			for midx, t := range e.Tag.Member {
+				if tout, ok := d.timeout(t.Timeout, Group, e.User, t.Member, "register-user", idx, midx); ok {
+					n := len(d.mp.invalid)
+					d.mp = d.mp.GroupUser(e.User, t.Member, tout)
+					d.locate(n, "register-user", idx, midx)
+				}
+			}
+		}
+	}
+	if p.Unregister != nil {
+		for idx, e := range p.Unregister.Entry {
+			for midx, t := range e.Tag.Member {
+				n := len(d.mp.invalid)
+				d.mp = d.mp.UnregisterIP(e.IP, t.Member)
+				d.locate(n, "unregister", idx, midx)
+			}
+		}
+	}
+	if p.Register != nil {
+		for idx, e := range p.Register.Entry {
+			for midx, t := range e.Tag.Member {
+				if tout, ok := d.timeout(t.Timeout, Register, e.IP, t.Member, "register", idx, midx); ok {
+					n := len(d.mp.invalid)
+					d.mp = d.mp.Register([]IPTag{{IP: e.IP, Tag: t.Member, Tout: tout, Persistent: e.Persistent == "1"}})
+					d.locate(n, "register", idx, midx)
+				}
+			}
+		}
+	}
+}
+
+// NewBuilderFromMessage returns an initialized UIDBuilder with the entries contained in the provided uid-message
+// along with the location of every entry that was rejected (see DecodeError). Rejected entries are also
+// available with Rejected() and make the final actions fail unless the builder is switched to lenient mode.
+// An error is returned if the message is not a version 1.0 or 2.0 "update" uid-message
+func NewBuilderFromMessage(u *x.UIDMessage) (mp UIDBuilder, rejected []DecodeError, err error) {
+	switch {
+	case u == nil:
+		err = errors.New("nil uid-message")
+	case u.Type != "update":
+		err = fmt.Errorf("unsupported uid-message type %q", u.Type)
+	case u.Version != "1.0" && u.Version != "2.0":
+		err = fmt.Errorf("unsupported uid-message version %q", u.Version)
+	}
+	if err != nil {
+		return
+	}
+	d := &decoder{mp: NewUIDBuilder()}
+	d.payload(u.Payload)
+	mp, rejected = d.mp, d.rejected
+	return
+}
+
+// Decode is like NewBuilderFromMessage() but it parses the raw uid-message XML document provided
+func Decode(data []byte) (mp UIDBuilder, rejected []DecodeError, err error) {
+	u := &x.UIDMessage{}
+	if err = xml.Unmarshal(data, u); err != nil {
+		err = fmt.Errorf("error unmarshaling uid-message (%v)", err)
+		return
+	}
+	return NewBuilderFromMessage(u)
+}
+
+// DecodeReader is like Decode() but it reads the uid-message XML document from r
+func DecodeReader(r io.Reader) (mp UIDBuilder, rejected []DecodeError, err error) {
+	var data []byte
+	if data, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+	return Decode(data)
+}
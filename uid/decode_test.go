@@ -0,0 +1,121 @@
+package uid_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	x "github.com/xhoms/panoslib/collection"
+	"github.com/xhoms/panoslib/uid"
+)
+
+func TestDecode(t *testing.T) {
+	doc := `
+<uid-message>
+	<version>2.0</version>
+	<type>update</type>
+	<payload>
+		<login>
+			<entry name="foo@test.local" ip="1.1.1.1" timeout="60"/>
+			<entry name="bar@test.local" ip="1.1.1.2" timeout="one hour"/>
+		</login>
+		<groups>
+			<entry name="admin">
+				<members>
+					<entry name="foo@test.local"/>
+					<entry name=""/>
+				</members>
+			</entry>
+		</groups>
+		<register>
+			<entry ip="2.2.2.2" persistent="1">
+				<tag>
+					<member timeout="3600">foo</member>
+					<member>bar&amp;baz</member>
+				</tag>
+			</entry>
+			<entry ip="not-an-ip">
+				<tag>
+					<member>foo</member>
+				</tag>
+			</entry>
+		</register>
+	</payload>
+</uid-message>
+`
+	mp, rejected, err := uid.DecodeReader(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		section       string
+		entry, member int
+		reason        error
+	}{
+		{"login", 1, -1, uid.ErrInvalidTimeout},
+		{"groups", 0, 1, uid.ErrEmptyUser},
+		{"register", 0, 1, uid.ErrTagChars},
+		{"register", 1, 0, uid.ErrInvalidIP},
+	}
+	if len(rejected) != len(expected) {
+		t.Fatalf("expected %v rejected entries, got %v", len(expected), rejected)
+	}
+	for idx, e := range expected {
+		r := rejected[idx]
+		if r.Section != e.section || r.Entry != e.entry || r.Member != e.member || !errors.Is(r, e.reason) {
+			t.Errorf("unexpected rejected entry %v", r)
+		}
+	}
+	if len(mp.Rejected()) != len(expected) || mp.Err() == nil {
+		t.Error("rejected entries not recorded in the builder")
+	}
+	var p *x.UIDMsgPayload
+	if p, err = mp.Lenient().Payload(nil); err == nil {
+		if p.Login != nil && len(p.Login.Entry) == 1 &&
+			p.Groups == nil &&
+			p.Register != nil && len(p.Register.Entry) == 1 && p.Register.Entry[0].Persistent == "1" {
+			return
+		}
+		err = errors.New("unexpected payload")
+	}
+	t.Error(err)
+}
+
+func TestDecodeVersion(t *testing.T) {
+	v1 := `<uid-message><version>1.0</version><type>update</type><payload>` +
+		`<logout><entry name="foo@test.local" ip="1.1.1.1"/></logout></payload></uid-message>`
+	if _, rejected, err := uid.Decode([]byte(v1)); err != nil || len(rejected) != 0 {
+		t.Errorf("unexpected error decoding a version 1.0 message: %v %v", err, rejected)
+	}
+	for _, doc := range []string{
+		`<uid-message><version>3.0</version><type>update</type></uid-message>`,
+		`<uid-message><version>2.0</version><type>query</type></uid-message>`,
+		`<uid-message><version>2.0`,
+	} {
+		if _, _, err := uid.Decode([]byte(doc)); err == nil {
+			t.Errorf("expected an error decoding %v", doc)
+		}
+	}
+}
+
+func TestBuilderFromPayloadSkips(t *testing.T) {
+	tout := "one hour"
+	p := &x.UIDMsgPayload{
+		Login: &x.UIDMsgPldLogInOut{Entry: []x.UIDMsgPldLogEntry{
+			{Name: "foo@test.local", IP: "1.1.1.1"},
+			{Name: "bar@test.local", IP: "1.1.1.2", Timeout: &tout},
+			{Name: "baz@test.local", IP: "not-an-ip"},
+		}},
+	}
+	mp := uid.NewBuilderFromPayload(p)
+	var err error
+	if err = mp.Err(); err == nil {
+		if p, err = mp.Payload(nil); err == nil {
+			if len(mp.Rejected()) == 0 && p.Login != nil && len(p.Login.Entry) == 1 {
+				return
+			}
+			err = errors.New("invalid entries not skipped")
+		}
+	}
+	t.Error(err)
+}
@@ -0,0 +1,99 @@
+package uid
+
+import (
+	"time"
+)
+
+// NeverExpire is the time.Duration to use with the "For" builder methods for entries that must not expire
+// (PAN-OS timeout "0")
+const NeverExpire time.Duration = -1
+
+// tout converts d into a PAN-OS timeout expressed in unit (rounding up) with max as the largest value
+// allowed. Durations out of range (including zero) produce ErrTimeoutRange
+func tout(d time.Duration, unit time.Duration, max uint) (t *uint, err error) {
+	var v uint
+	switch {
+	case d == NeverExpire:
+	case d <= 0, d > time.Duration(max)*unit:
+		err = ErrTimeoutRange
+		return
+	default:
+		v = uint((d + unit - 1) / unit)
+	}
+	t = &v
+	return
+}
+
+// LoginTimeout converts d into a user-to-ip timeout (minutes, rounded up). NeverExpire is converted to 0.
+// An ErrTimeoutRange error is returned for zero, negative or larger than MaxLoginTimeout minutes durations
+func LoginTimeout(d time.Duration) (*uint, error) {
+	return tout(d, time.Minute, MaxLoginTimeout)
+}
+
+// TagTimeout converts d into an ip-to-tag or user-to-group timeout (seconds, rounded up). NeverExpire is
+// converted to 0. An ErrTimeoutRange error is returned for zero, negative or larger than MaxTagTimeout
+// seconds durations
+func TagTimeout(d time.Duration) (*uint, error) {
+	return tout(d, time.Second, MaxTagTimeout)
+}
+
+// RegisterIPFor is like RegisterIP() but the timeout is provided as a time.Duration (see TagTimeout())
+func (mp UIDBuilder) RegisterIPFor(ip, tag string, d time.Duration) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	t, err := TagTimeout(d)
+	if err != nil {
+		mpB = mp.reject(Register, ip, tag, err)
+		return
+	}
+	mpB = mp.RegisterIP(ip, tag, t)
+	return
+}
+
+// RegisterIPPersistentFor is like RegisterIPPersistent() but the timeout is provided as a time.Duration
+// (see TagTimeout())
+func (mp UIDBuilder) RegisterIPPersistentFor(ip, tag string, d time.Duration) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	t, err := TagTimeout(d)
+	if err != nil {
+		mpB = mp.reject(Register, ip, tag, err)
+		return
+	}
+	mpB = mp.RegisterIPPersistent(ip, tag, t)
+	return
+}
+
+// LoginUserFor is like LoginUser() but the timeout is provided as a time.Duration (see LoginTimeout())
+func (mp UIDBuilder) LoginUserFor(user, ip string, d time.Duration) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	t, err := LoginTimeout(d)
+	if err != nil {
+		mpB = mp.reject(Login, user, ip, err)
+		return
+	}
+	mpB = mp.LoginUser(user, ip, t)
+	return
+}
+
+// GroupUserFor is like GroupUser() but the timeout is provided as a time.Duration (see TagTimeout())
+func (mp UIDBuilder) GroupUserFor(user, group string, d time.Duration) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	t, err := TagTimeout(d)
+	if err != nil {
+		mpB = mp.reject(Group, user, group, err)
+		return
+	}
+	mpB = mp.GroupUser(user, group, t)
+	return
+}
@@ -0,0 +1,57 @@
+package uid_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xhoms/panoslib/uid"
+)
+
+func TestTimeoutConversion(t *testing.T) {
+	cases := []struct {
+		conv     func(time.Duration) (*uint, error)
+		d        time.Duration
+		expected uint
+		err      error
+	}{
+		{uid.LoginTimeout, 90 * time.Second, 2, nil},
+		{uid.LoginTimeout, time.Hour, 60, nil},
+		{uid.LoginTimeout, uid.NeverExpire, 0, nil},
+		{uid.LoginTimeout, 0, 0, uid.ErrTimeoutRange},
+		{uid.LoginTimeout, 31 * 24 * time.Hour, 0, uid.ErrTimeoutRange},
+		{uid.TagTimeout, 1500 * time.Millisecond, 2, nil},
+		{uid.TagTimeout, 30 * 24 * time.Hour, uid.MaxTagTimeout, nil},
+		{uid.TagTimeout, -time.Second, 0, uid.ErrTimeoutRange},
+	}
+	for idx, c := range cases {
+		tout, err := c.conv(c.d)
+		switch {
+		case c.err != nil && !errors.Is(err, c.err):
+			t.Errorf("case %v: expected error %v, got %v", idx, c.err, err)
+		case c.err == nil && (err != nil || *tout != c.expected):
+			t.Errorf("case %v: expected %v, got %v (%v)", idx, c.expected, tout, err)
+		}
+	}
+}
+
+func TestDurationBuilder(t *testing.T) {
+	mp := uid.NewUIDBuilder().
+		LoginUserFor("foo@test.local", "1.1.1.1", 2*time.Hour).
+		GroupUserFor("foo@test.local", "admin", uid.NeverExpire).
+		RegisterIPFor("1.1.1.1", "foo", 10*time.Minute).
+		RegisterIPPersistentFor("1.1.1.2", "foo", 0)
+	if len(mp.Rejected()) != 1 || !errors.Is(mp.Rejected()[0], uid.ErrTimeoutRange) {
+		t.Fatalf("unexpected rejected entries %v", mp.Rejected())
+	}
+	p, err := mp.Lenient().Payload(nil)
+	if err == nil {
+		if p.Login != nil && *p.Login.Entry[0].Timeout == "120" &&
+			p.RegisterUser != nil && *p.RegisterUser.Entry[0].Tag.Member[0].Timeout == "0" &&
+			p.Register != nil && len(p.Register.Entry) == 1 && *p.Register.Entry[0].Tag.Member[0].Timeout == "600" {
+			return
+		}
+		err = errors.New("unexpected payload")
+	}
+	t.Error(err)
+}
@@ -1,9 +1,11 @@
 package uid
 
-// IPTag is a convenience struct to create a list of ip-to-tag UserID entries
+// IPTag is a convenience struct to create a list of ip-to-tag UserID entries. Persistent entries survive
+// a device reboot (it is ignored in the "unregister" section)
 type IPTag struct {
-	IP, Tag string
-	Tout    *uint
+	IP, Tag    string
+	Tout       *uint
+	Persistent bool
 }
 
 // UserMap is a convenience struct to create a list of user-to-ip UserID entries
@@ -12,8 +14,26 @@ type UserMap struct {
 	Tout     *uint
 }
 
+// GroupMembers is a convenience struct to create a list of group mapping UserID entries. Users is the full
+// list of members of the group
+type GroupMembers struct {
+	Group string
+	Users []string
+}
+
 // UserGroup is a convenience struct to create a list of user-to-group UserID entries
 type UserGroup struct {
 	User, Group string
 	Tout        *uint
 }
+
+// Entry is a single UIDBuilder entry as provided by Entries(). Subject and Value follow the same convention
+// than the Monitor interface (ip and tag, user and ip or user and group). Membership entries have the group
+// as Subject and its full list of users in Members
+type Entry struct {
+	Op             Operation
+	Subject, Value string
+	Tout           *uint
+	Persistent     bool
+	Members        []string
+}
@@ -26,7 +26,7 @@ func ExampleUIDBuilder() {
 	tag := []uid.IPTag{
 		{Tag: "windows", IP: "1.1.1.1"},
 		{Tag: "linux", IP: "2.2.2.2"},
-		{Tag: "avscanned", IP: "2.2.22", Tout: &tout},
+		{Tag: "avscanned", IP: "2.2.2.22", Tout: &tout},
 	}
 	if uidmsg, err := uid.NewUIDBuilder().
 		Login(login).
@@ -0,0 +1,83 @@
+package uid
+
+import (
+	"context"
+	"encoding/xml"
+	"sync"
+	"time"
+
+	x "github.com/xhoms/panoslib/collection"
+)
+
+// FleetResult is the outcome of pushing a User-ID message to a single Target
+type FleetResult struct {
+	Target   Target
+	Response *x.APIResponse
+	Err      error
+	Latency  time.Duration
+}
+
+// Fleet describes a list of devices that must receive the same User-ID message
+type Fleet struct {
+	Targets []Target
+	// Workers is the maximum number of concurrent pushes. Values lower than 1 mean one per target
+	Workers int
+	Client  Client
+	// Retry is the policy applied to each target (nil means a single attempt)
+	Retry *RetryPolicy
+}
+
+/*
+PushFleet is a final action. It merges all accumulated data into a ready-to use
+PAN-OS XML User-ID API message and sends it concurrently to all devices in the
+fleet. The returned list contains the validated response (see Validate()), error and
+latency for every target in the same order than f.Targets (a target listed more than
+once is pushed and reported once per occurrence). An error is returned only if the
+message can't be built, in which case nothing is sent.
+
+If a variable implementing the Monitor interface is provided then a log entry
+will be issued to it for every entry in the payload (once, no matter the number of
+targets). Order of log entries will be unregister > unregister-user > logout >
+login > groups > register-user > register
+*/
+func (mp UIDBuilder) PushFleet(ctx context.Context, f Fleet, m Monitor) (res []FleetResult, err error) {
+	var u *x.UIDMessage
+	if u, err = mp.UIDMessage(m); err != nil {
+		return
+	}
+	var cmd []byte
+	if cmd, err = xml.Marshal(u); err != nil {
+		return
+	}
+	workers := f.Workers
+	if workers < 1 || workers > len(f.Targets) {
+		workers = len(f.Targets)
+	}
+	res = make([]FleetResult, len(f.Targets))
+	jobs := make(chan int)
+	wg := &sync.WaitGroup{}
+	wg.Add(workers)
+	for idx := 0; idx < workers; idx++ {
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				res[idx] = f.push(ctx, f.Targets[idx], cmd)
+			}
+		}()
+	}
+	for idx := range f.Targets {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+	return
+}
+
+func (f Fleet) push(ctx context.Context, t Target, cmd []byte) (r FleetResult) {
+	start := time.Now()
+	r.Target = t
+	r.Response, r.Err = Validate(t.send(ctx, cmd, f.Client, f.Retry))
+	r.Err = Redact(r.Err, t.APIKey)
+	r.Latency = time.Since(start)
+	return
+}
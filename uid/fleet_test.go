@@ -0,0 +1,77 @@
+package uid_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xhoms/panoslib/uid"
+)
+
+// fleetClient replies with an error response for the hosts in fail and tracks concurrency
+type fleetClient struct {
+	fail      map[string]bool
+	lock      sync.Mutex
+	active    int
+	maxActive int
+	requests  int
+}
+
+func (c *fleetClient) Do(req *http.Request) (resp *http.Response, err error) {
+	c.lock.Lock()
+	c.requests++
+	c.active++
+	if c.active > c.maxActive {
+		c.maxActive = c.active
+	}
+	c.lock.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	c.lock.Lock()
+	c.active--
+	c.lock.Unlock()
+	body := successBody
+	if c.fail[req.URL.Host] {
+		body = `<response status="error"><msg><line>failure</line></msg></response>`
+	}
+	resp = &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		StatusCode: http.StatusOK,
+	}
+	return
+}
+
+func TestPushFleet(t *testing.T) {
+	c := &fleetClient{fail: map[string]bool{"fw3:443": true}}
+	f := uid.Fleet{Workers: 2, Client: c}
+	for idx := 0; idx < 6; idx++ {
+		f.Targets = append(f.Targets, uid.Target{HostPort: fmt.Sprintf("fw%v:443", idx), APIKey: "apikey"})
+	}
+	// duplicated targets get their own result
+	f.Targets = append(f.Targets, f.Targets[3])
+	var err error
+	var res []uid.FleetResult
+	if res, err = uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		PushFleet(context.Background(), f, nil); err == nil {
+		switch {
+		case len(res) != 7, c.requests != 7:
+			err = fmt.Errorf("unexpected number of results (%v)", len(res))
+		case c.maxActive > 2:
+			err = fmt.Errorf("worker limit exceeded (%v)", c.maxActive)
+		case res[3].Err == nil, res[6].Err == nil, res[0].Err != nil, res[0].Response == nil:
+			err = fmt.Errorf("unexpected per-device results")
+		case res[5].Target != f.Targets[5]:
+			err = fmt.Errorf("results out of order")
+		case res[0].Latency <= 0:
+			err = fmt.Errorf("latency not measured")
+		default:
+			return
+		}
+	}
+	t.Error(err)
+}
@@ -0,0 +1,114 @@
+package uid
+
+import "fmt"
+
+// entry returns the exported version of the payload entry (copying its timeout and members)
+func (e payload) entry() (out Entry) {
+	switch {
+	case e.register != nil:
+		out = Entry{Op: Register, Subject: e.register.IP, Value: e.register.Tag, Tout: copyTout(e.register.Tout), Persistent: e.register.Persistent}
+	case e.unregister_ip != nil && e.unregister_tag != nil:
+		out = Entry{Op: Unregister, Subject: *e.unregister_ip, Value: *e.unregister_tag}
+	case e.login != nil:
+		out = Entry{Op: Login, Subject: e.login.User, Value: e.login.IP, Tout: copyTout(e.login.Tout)}
+	case e.logout_user != nil && e.logout_ip != nil:
+		out = Entry{Op: Logout, Subject: *e.logout_user, Value: *e.logout_ip}
+	case e.group != nil:
+		out = Entry{Op: Group, Subject: e.group.User, Value: e.group.Group, Tout: copyTout(e.group.Tout)}
+	case e.ungroup_user != nil && e.ungroup_group != nil:
+		out = Entry{Op: Ungroup, Subject: *e.ungroup_user, Value: *e.ungroup_group}
+	case e.members != nil:
+		out = Entry{Op: Membership, Subject: e.members.Group, Members: make([]string, len(e.members.Users))}
+		copy(out.Members, e.members.Users)
+	}
+	return
+}
+
+// addEntry adds the entry to the builder using the method of its operation (so it is validated)
+func (mp UIDBuilder) addEntry(e Entry) (mpB UIDBuilder) {
+	switch e.Op {
+	case Register:
+		mpB = mp.Register([]IPTag{{IP: e.Subject, Tag: e.Value, Tout: e.Tout, Persistent: e.Persistent}})
+	case Unregister:
+		mpB = mp.UnregisterIP(e.Subject, e.Value)
+	case Login:
+		mpB = mp.LoginUser(e.Subject, e.Value, e.Tout)
+	case Logout:
+		mpB = mp.LogoutUser(e.Subject, e.Value)
+	case Group:
+		mpB = mp.GroupUser(e.Subject, e.Value, e.Tout)
+	case Ungroup:
+		mpB = mp.UngroupUser(e.Subject, e.Value)
+	case Membership:
+		mpB = mp.SetGroupMembers(e.Subject, e.Members)
+	default:
+		mpB = mp.reject(e.Op, e.Subject, e.Value, fmt.Errorf("unknown operation %v", e.Op))
+	}
+	return
+}
+
+// Len returns the number of entries in the builder (rejected ones are not counted). Entries are counted
+// as added, before the deduplication (and collapsing) performed by the final actions
+func (mp UIDBuilder) Len() int {
+	return len(mp.entries)
+}
+
+// Stats returns the number of entries in the builder for each operation (see Len())
+func (mp UIDBuilder) Stats() (s map[Operation]int) {
+	s = make(map[Operation]int)
+	for _, e := range mp.entries {
+		s[e.entry().Op]++
+	}
+	return
+}
+
+// Entries returns the list of entries in the builder in the order they were added (see Len())
+func (mp UIDBuilder) Entries() (out []Entry) {
+	out = make([]Entry, len(mp.entries))
+	for idx, e := range mp.entries {
+		out[idx] = e.entry()
+	}
+	return
+}
+
+// Each calls f for every entry in the builder in the order they were added until it returns false
+func (mp UIDBuilder) Each(f func(e Entry) bool) {
+	for _, e := range mp.entries {
+		if !f(e.entry()) {
+			return
+		}
+	}
+}
+
+// Filter returns a new builder (with the same mode and rejected entries) containing only the entries for
+// which f returns true
+func (mp UIDBuilder) Filter(f func(e Entry) bool) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	mpB = mp
+	mpB.entries, mpB.entriesTip = make([]payload, 0, len(mp.entries)), nil
+	for _, e := range mp.entries {
+		if f(e.entry()) {
+			mpB.entries = append(mpB.entries, e)
+		}
+	}
+	return
+}
+
+// Map returns a new builder (with the same mode and rejected entries) with the entries returned by f for
+// each entry of this builder. Returned entries are validated as if they were added with the method of their
+// operation (an entry can be mapped into a different operation)
+func (mp UIDBuilder) Map(f func(e Entry) Entry) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	mpB = mp
+	mpB.entries, mpB.entriesTip = nil, nil
+	for _, e := range mp.entries {
+		mpB = mpB.addEntry(f(e.entry()))
+	}
+	return
+}
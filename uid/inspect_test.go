@@ -0,0 +1,85 @@
+package uid_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	x "github.com/xhoms/panoslib/collection"
+	"github.com/xhoms/panoslib/uid"
+)
+
+func inspectBuilder() uid.UIDBuilder {
+	var tout uint = 60
+	return uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "allowed", &tout).
+		RegisterIP("1.1.1.1", "denied", nil).
+		UnregisterIP("2.2.2.2", "allowed").
+		LoginUser("foo@TEST.LOCAL", "1.1.1.1", &tout).
+		LoginUser("bar@TEST.LOCAL", "2.2.2.2", nil).
+		GroupUser("foo@TEST.LOCAL", "admin", nil).
+		SetGroupMembers("admin", []string{"foo@TEST.LOCAL"})
+}
+
+func TestStats(t *testing.T) {
+	mp := inspectBuilder()
+	s := mp.Stats()
+	if mp.Len() != 7 || len(mp.Entries()) != 7 ||
+		s[uid.Register] != 2 || s[uid.Unregister] != 1 || s[uid.Login] != 2 || s[uid.Group] != 1 || s[uid.Membership] != 1 {
+		t.Errorf("unexpected stats %v (len %v)", s, mp.Len())
+	}
+	count := 0
+	mp.Each(func(e uid.Entry) bool {
+		count++
+		return e.Op != uid.Login
+	})
+	if count != 4 {
+		t.Errorf("Each did not stop at the first login (%v entries)", count)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	mp := inspectBuilder().Filter(func(e uid.Entry) bool {
+		return (e.Op != uid.Register && e.Op != uid.Unregister) || e.Value == "allowed"
+	})
+	p, err := mp.Payload(nil)
+	if err == nil {
+		if mp.Len() == 6 && p.Register != nil && len(p.Register.Entry[0].Tag.Member) == 1 &&
+			p.Register.Entry[0].Tag.Member[0].Member == "allowed" && p.Unregister != nil {
+			return
+		}
+		err = errors.New("unexpected payload")
+	}
+	t.Error(err)
+}
+
+func TestMap(t *testing.T) {
+	mp := inspectBuilder().Map(func(e uid.Entry) uid.Entry {
+		switch e.Op {
+		case uid.Login, uid.Group:
+			e.Subject = strings.ToLower(e.Subject)
+		case uid.Membership:
+			for idx := range e.Members {
+				e.Members[idx] = strings.ToLower(e.Members[idx])
+			}
+		case uid.Unregister:
+			e.Subject = "invalid"
+		}
+		return e
+	})
+	if len(mp.Rejected()) != 1 || !errors.Is(mp.Rejected()[0], uid.ErrInvalidIP) {
+		t.Fatalf("unexpected rejected entries %v", mp.Rejected())
+	}
+	var p *x.UIDMsgPayload
+	var err error
+	p, err = mp.Lenient().Payload(nil)
+	if err == nil {
+		if p.Login != nil && p.Login.Entry[0].Name == "bar@test.local" && *p.Login.Entry[1].Timeout == "60" &&
+			p.RegisterUser.Entry[0].User == "foo@test.local" &&
+			p.Groups.Entry[0].Members.Entry[0].Name == "foo@test.local" && p.Unregister == nil {
+			return
+		}
+		err = errors.New("unexpected payload")
+	}
+	t.Error(err)
+}
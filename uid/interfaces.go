@@ -1,7 +1,11 @@
 package uid
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+)
 
+// Operation identifies the kind of User-ID entry reported to a Monitor
 type Operation int
 
 const (
@@ -11,8 +15,33 @@ const (
 	Ungroup
 	Register
 	Unregister
+	// Membership reports a group mapping member list: a log entry with an empty value starts the list of
+	// the group (replacing the previous one) and it is followed by a log entry per user (see Payload())
+	Membership
 )
 
+func (op Operation) String() (s string) {
+	switch op {
+	case Login:
+		s = "login"
+	case Logout:
+		s = "logout"
+	case Group:
+		s = "register-user"
+	case Ungroup:
+		s = "unregister-user"
+	case Register:
+		s = "register"
+	case Unregister:
+		s = "unregister"
+	case Membership:
+		s = "groups"
+	default:
+		s = fmt.Sprintf("Operation(%d)", int(op))
+	}
+	return
+}
+
 // Client is a simplified http.Client interface
 type Client interface {
 	Do(req *http.Request) (*http.Response, error)
@@ -23,3 +52,26 @@ type Client interface {
 type Monitor interface {
 	Log(op Operation, subject, value string, tout *uint)
 }
+
+// PersistentMonitor is an optional extension of the Monitor interface. When implemented, ip-to-tag entries
+// flagged as persistent are reported with LogPersistent() instead of Log() with the Register operation
+type PersistentMonitor interface {
+	Monitor
+	LogPersistent(ip, tag string, tout *uint)
+}
+
+// GroupMonitor is an optional extension of the Monitor interface. When implemented, group mapping entries
+// are reported with LogMembers() (once per group with its full member list, which replaces any previous
+// one) instead of Log() with the Membership operation
+type GroupMonitor interface {
+	Monitor
+	LogMembers(group string, users []string)
+}
+
+// State describes an entity capable of listing the User-ID entries known to be active in a device (i.e. a
+// MemMonitor or a Snapshot built with QueryState()). It is the knowledge source used by Reconcile()
+type State interface {
+	IPTags() []IPTag
+	UserMaps() []UserMap
+	UserGroups() []UserGroup
+}
@@ -0,0 +1,125 @@
+package uid
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	x "github.com/xhoms/panoslib/collection"
+)
+
+// Keygen requests an API key for the provided credentials (type=keygen)
+func Keygen(hostport, user, password string, c Client) (key string, err error) {
+	values := url.Values{
+		"type":     []string{"keygen"},
+		"user":     []string{user},
+		"password": []string{password},
+	}
+	var req *http.Request
+	if req, err = newRequest(context.Background(), hostport, strings.NewReader(values.Encode())); err == nil {
+		var body []byte
+		if body, _, err = validate(c.Do(req)); err == nil {
+			resp := &x.KeygenResponse{}
+			if err = xml.Unmarshal(body, resp); err == nil {
+				if resp.Result == nil || resp.Result.Key == "" {
+					err = errors.New("keygen response without key")
+				} else {
+					key = resp.Result.Key
+				}
+			}
+		}
+	}
+	err = Redact(err, password)
+	return
+}
+
+// Session pushes User-ID messages to a device using credentials instead of an API key. The key is
+// generated on first use, cached and re-generated when the device reports it as invalid. Use an
+// initialized version as provided by NewSession() or NewSessionTarget(). Session methods are goroutine safe
+type Session struct {
+	t              Target
+	user, password string
+	c              Client
+	lock           *sync.Mutex
+	key            string
+}
+
+// NewSession returns a ready-to-consume Session
+func NewSession(hostport, user, password string, c Client) (s *Session) {
+	return NewSessionTarget(Target{HostPort: hostport}, user, password, c)
+}
+
+// NewSessionTarget returns a ready-to-consume Session that pushes to the device described by t (its APIKey
+// field is ignored)
+func NewSessionTarget(t Target, user, password string, c Client) (s *Session) {
+	t.APIKey = ""
+	s = &Session{
+		t:        t,
+		user:     user,
+		password: password,
+		c:        c,
+		lock:     &sync.Mutex{},
+	}
+	return
+}
+
+// Key returns the cached API key, generating it if needed
+func (s *Session) Key() (key string, err error) {
+	return s.renew("")
+}
+
+// renew returns the cached key unless it is the stale one, in which case a new one is generated
+func (s *Session) renew(stale string) (key string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.key == "" || s.key == stale {
+		s.key = ""
+		if key, err = Keygen(s.t.HostPort, s.user, s.password, s.c); err == nil {
+			s.key = key
+		}
+		return
+	}
+	key = s.key
+	return
+}
+
+/*
+Push is a final action. It merges all accumulated data in mp into a ready-to use
+PAN-OS XML User-ID API message, sends it to the device (see PushContext()) and
+validates the response (see Validate()). If the device reports an authentication
+failure a new API key is generated and the message is sent again (once).
+
+If a variable implementing the Monitor interface is provided then a log entry
+will be issued to it for every entry in the payload (once, no matter the number of
+attempts). Order of log entries will be unregister > unregister-user > logout >
+login > groups > register-user > register
+*/
+func (s *Session) Push(ctx context.Context, mp UIDBuilder, m Monitor, policy *RetryPolicy) (apiResp *x.APIResponse, err error) {
+	var u *x.UIDMessage
+	if u, err = mp.UIDMessage(m); err != nil {
+		return
+	}
+	var cmd []byte
+	if cmd, err = xml.Marshal(u); err != nil {
+		return
+	}
+	var key string
+	t := s.t
+	for attempt := 0; attempt < 2; attempt++ {
+		if key, err = s.renew(key); err != nil {
+			return
+		}
+		t.APIKey = key
+		apiResp, err = Validate(t.send(ctx, cmd, s.c, policy))
+		err = Redact(err, key, s.password)
+		var aerr *APIError
+		if !errors.As(err, &aerr) || !aerr.IsAuth() {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package uid_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/xhoms/panoslib/uid"
+)
+
+// keygenClient issues a new key on every keygen request and only accepts the last one issued
+type keygenClient struct {
+	issued  int
+	pushes  int
+	lastKey string
+}
+
+func (c *keygenClient) Do(req *http.Request) (resp *http.Response, err error) {
+	if err = req.ParseForm(); err != nil {
+		return
+	}
+	switch req.PostForm.Get("type") {
+	case "keygen":
+		if req.PostForm.Get("user") != "admin" || req.PostForm.Get("password") != "secret" {
+			return response(http.StatusForbidden, `<response status="error" code="403"><result><msg>Invalid Credential</msg></result></response>`), nil
+		}
+		c.issued++
+		c.lastKey = fmt.Sprintf("key%v", c.issued)
+		return response(http.StatusOK, `<response status="success"><result><key>`+c.lastKey+`</key></result></response>`), nil
+	case "user-id":
+		c.pushes++
+		if req.PostForm.Get("key") != c.lastKey {
+			return response(http.StatusForbidden, `<response status="error" code="403"><result><msg>Invalid key</msg></result></response>`), nil
+		}
+		return response(http.StatusOK, successBody), nil
+	}
+	return response(http.StatusBadRequest, ""), nil
+}
+
+func TestKeygen(t *testing.T) {
+	c := &keygenClient{}
+	if key, err := uid.Keygen("vm.test.local", "admin", "secret", c); err != nil || key != "key1" {
+		t.Errorf("unexpected key %q (%v)", key, err)
+	}
+	_, err := uid.Keygen("vm.test.local", "admin", "wrong", c)
+	var aerr *uid.APIError
+	if !errors.As(err, &aerr) || !aerr.IsAuth() {
+		t.Errorf("expected an auth error, got %v", err)
+	}
+}
+
+func TestSession(t *testing.T) {
+	c := &keygenClient{}
+	s := uid.NewSession("vm.test.local", "admin", "secret", c)
+	mp := uid.NewUIDBuilder().RegisterIP("1.1.1.1", "foo", nil)
+	var err error
+	if _, err = s.Push(context.Background(), mp, nil, nil); err == nil {
+		// the key is invalidated (i.e. regenerated by someone else)
+		c.lastKey = "other"
+		c.issued = 5
+		if _, err = s.Push(context.Background(), mp, nil, nil); err == nil {
+			var key string
+			if key, err = s.Key(); err == nil {
+				if key == "key6" && c.pushes == 3 {
+					return
+				}
+				err = fmt.Errorf("unexpected key %q after %v pushes", key, c.pushes)
+			}
+		}
+	}
+	t.Error(err)
+}
@@ -1,12 +1,13 @@
 package uid
 
 import (
+	"context"
 	"encoding/xml"
-	"fmt"
+	"io"
 	"net/http"
-	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	x "github.com/xhoms/panoslib/collection"
 )
@@ -21,14 +22,23 @@ type payload struct {
 	group          *UserGroup
 	ungroup_user   *string
 	ungroup_group  *string
+	members        *GroupMembers
 }
 
 // UIDBuilder provides a "functional programming"-like constructor to build a PAN-OS XML User-ID API Payload.
-// Methods for UIDBuilder are not thread safe. All operations between NewUIDBuilder() and the final action
-// (Payload(), UIDMessage() or Push()) must happen inside the same goroutine
+// UIDBuilder values are immutable: methods return a new builder and never modify the receiver nor keep
+// references to the slices or timeouts provided, so a base builder can be branched many times (even from
+// different goroutines) and each branch is independent from the others.
+// Entries are validated as they are added. Invalid ones are rejected and make the final action fail with
+// a *ValidationError listing all of them (see Lenient() to just drop them instead)
 type UIDBuilder struct {
-	entries []payload
-	err     error
+	entries  []payload
+	invalid  []EntryError
+	err      error
+	collapse bool
+	lenient  bool
+	// length claimed on the backing arrays of entries and invalid (see claim())
+	entriesTip, invalidTip *int64
 }
 
 // NewUIDBuilder returns an uninitialized UIDBuilder struct. Functional equivalent to UIDBuilder{}
@@ -37,57 +47,52 @@ func NewUIDBuilder() (mp UIDBuilder) {
 	return
 }
 
+// key identifies the subject of the entry no matter if it is an add or a remove operation
+func (e payload) key() (k string) {
+	switch {
+	case e.register != nil:
+		k = "dag\x00" + e.register.IP + "\x00" + e.register.Tag
+	case e.unregister_ip != nil && e.unregister_tag != nil:
+		k = "dag\x00" + *e.unregister_ip + "\x00" + *e.unregister_tag
+	case e.login != nil:
+		k = "uid\x00" + e.login.User + "\x00" + e.login.IP
+	case e.logout_user != nil && e.logout_ip != nil:
+		k = "uid\x00" + *e.logout_user + "\x00" + *e.logout_ip
+	case e.group != nil:
+		k = "dug\x00" + e.group.User + "\x00" + e.group.Group
+	case e.ungroup_user != nil && e.ungroup_group != nil:
+		k = "dug\x00" + *e.ungroup_user + "\x00" + *e.ungroup_group
+	case e.members != nil:
+		k = "grp\x00" + e.members.Group
+	}
+	return
+}
+
+// collapse returns the list of entries keeping only the last one for each key
+func collapse(entries []payload) (out []payload) {
+	last := make(map[string]int, len(entries))
+	for idx, e := range entries {
+		last[e.key()] = idx
+	}
+	out = make([]payload, 0, len(last))
+	for idx, e := range entries {
+		if last[e.key()] == idx {
+			out = append(out, e)
+		}
+	}
+	return
+}
+
 // NewBuilderFromPayload returns an initialized UIDBuilder struct with data contained in the provided message payload.
 // Its common use case is to provide augmentation to an existing message of for "man-in-the-middle" applications.
-// For the latter see additional details in the MemMonitor type
+// For the latter see additional details in the MemMonitor type and the uidproxy package.
+// Entries that fail validation (including the ones with an invalid timeout) are skipped. Use
+// NewBuilderFromMessage() to learn about them and their location in the payload
 func NewBuilderFromPayload(p *x.UIDMsgPayload) (mp UIDBuilder) {
-	mp = NewUIDBuilder()
-	if p != nil {
-		if p.Logout != nil {
-			for _, e := range p.Logout.Entry {
-				mp = mp.LogoutUser(e.Name, e.IP)
-			}
-		}
-		if p.Login != nil {
-			for _, e := range p.Login.Entry {
-				if tout, err := ptrstr2uint(e.Timeout); err == nil {
-					mp = mp.LoginUser(e.Name, e.IP, tout)
-				}
-			}
-		}
-		if p.UnregisterUser != nil {
-			for _, e := range p.UnregisterUser.Entry {
-				for _, t := range e.Tag.Member {
-					mp = mp.UngroupUser(e.User, t.Member)
-				}
-			}
-		}
-		if p.RegisterUser != nil {
-			for _, e := range p.RegisterUser.Entry {
-				for _, t := range e.Tag.Member {
-					if tout, err := ptrstr2uint(t.Timeout); err == nil {
-						mp = mp.GroupUser(e.User, t.Member, tout)
-					}
-				}
-			}
-		}
-		if p.Unregister != nil {
-			for _, e := range p.Unregister.Entry {
-				for _, t := range e.Tag.Member {
-					mp = mp.UnregisterIP(e.IP, t.Member)
-				}
-			}
-		}
-		if p.Register != nil {
-			for _, e := range p.Register.Entry {
-				for _, t := range e.Tag.Member {
-					if tout, err := ptrstr2uint(t.Timeout); err == nil {
-						mp = mp.RegisterIP(e.IP, t.Member, tout)
-					}
-				}
-			}
-		}
-	}
+	d := &decoder{mp: NewUIDBuilder()}
+	d.payload(p)
+	mp = d.mp
+	mp.invalid, mp.invalidTip = nil, nil
 	return
 }
 
@@ -97,12 +102,18 @@ func (mp UIDBuilder) Register(dag []IPTag) (mpB UIDBuilder) {
 		mpB = UIDBuilder{err: mp.err}
 		return
 	}
-	mpC := UIDBuilder{entries: make([]payload, len(dag))}
+	mpC := UIDBuilder{entries: make([]payload, 0, len(dag))}
 
 	for idx := range dag {
-		mpC.entries[idx] = payload{
-			register: &dag[idx],
+		if err := check(Register, dag[idx].IP, dag[idx].Tag, dag[idx].Tout); err != nil {
+			mpC = mpC.reject(Register, dag[idx].IP, dag[idx].Tag, err)
+			continue
 		}
+		e := dag[idx]
+		e.Tout = copyTout(e.Tout)
+		mpC.entries = append(mpC.entries, payload{
+			register: &e,
+		})
 	}
 	mpB = mp.Add(mpC)
 	return
@@ -118,19 +129,35 @@ func (mp UIDBuilder) RegisterIP(ip, tag string, tout *uint) (mpB UIDBuilder) {
 	return
 }
 
+// RegisterIPPersistent is used to add as single ip-to-tag entry flagged as persistent in the User-ID payload.
+// Persistent registrations survive a device reboot
+func (mp UIDBuilder) RegisterIPPersistent(ip, tag string, tout *uint) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	mpB = mp.Register([]IPTag{{IP: ip, Tag: tag, Tout: tout, Persistent: true}})
+	return
+}
+
 // Unregister is used to add a list of ip-to-tag entries in the "unregister" section into the User-ID payload
 func (mp UIDBuilder) Unregister(dag []IPTag) (mpB UIDBuilder) {
 	if mp.err != nil {
 		mpB = UIDBuilder{err: mp.err}
 		return
 	}
-	mpC := UIDBuilder{entries: make([]payload, len(dag))}
+	mpC := UIDBuilder{entries: make([]payload, 0, len(dag))}
 
 	for idx := range dag {
-		mpC.entries[idx] = payload{
-			unregister_ip:  &dag[idx].IP,
-			unregister_tag: &dag[idx].Tag,
+		if err := check(Unregister, dag[idx].IP, dag[idx].Tag, nil); err != nil {
+			mpC = mpC.reject(Unregister, dag[idx].IP, dag[idx].Tag, err)
+			continue
 		}
+		ip, tag := dag[idx].IP, dag[idx].Tag
+		mpC.entries = append(mpC.entries, payload{
+			unregister_ip:  &ip,
+			unregister_tag: &tag,
+		})
 	}
 	mpB = mp.Add(mpC)
 	return
@@ -152,12 +179,18 @@ func (mp UIDBuilder) Login(uid []UserMap) (mpB UIDBuilder) {
 		mpB = UIDBuilder{err: mp.err}
 		return
 	}
-	mpC := UIDBuilder{entries: make([]payload, len(uid))}
+	mpC := UIDBuilder{entries: make([]payload, 0, len(uid))}
 
 	for idx := range uid {
-		mpC.entries[idx] = payload{
-			login: &uid[idx],
+		if err := check(Login, uid[idx].User, uid[idx].IP, uid[idx].Tout); err != nil {
+			mpC = mpC.reject(Login, uid[idx].User, uid[idx].IP, err)
+			continue
 		}
+		e := uid[idx]
+		e.Tout = copyTout(e.Tout)
+		mpC.entries = append(mpC.entries, payload{
+			login: &e,
+		})
 	}
 	mpB = mp.Add(mpC)
 	return
@@ -179,13 +212,18 @@ func (mp UIDBuilder) Logout(uid []UserMap) (mpB UIDBuilder) {
 		mpB = UIDBuilder{err: mp.err}
 		return
 	}
-	mpC := UIDBuilder{entries: make([]payload, len(uid))}
+	mpC := UIDBuilder{entries: make([]payload, 0, len(uid))}
 
 	for idx := range uid {
-		mpC.entries[idx] = payload{
-			logout_user: &uid[idx].User,
-			logout_ip:   &uid[idx].IP,
+		if err := check(Logout, uid[idx].User, uid[idx].IP, nil); err != nil {
+			mpC = mpC.reject(Logout, uid[idx].User, uid[idx].IP, err)
+			continue
 		}
+		user, ip := uid[idx].User, uid[idx].IP
+		mpC.entries = append(mpC.entries, payload{
+			logout_user: &user,
+			logout_ip:   &ip,
+		})
 	}
 	mpB = mp.Add(mpC)
 	return
@@ -207,12 +245,18 @@ func (mp UIDBuilder) Group(dug []UserGroup) (mpB UIDBuilder) {
 		mpB = UIDBuilder{err: mp.err}
 		return
 	}
-	mpC := UIDBuilder{entries: make([]payload, len(dug))}
+	mpC := UIDBuilder{entries: make([]payload, 0, len(dug))}
 
 	for idx := range dug {
-		mpC.entries[idx] = payload{
-			group: &dug[idx],
+		if err := check(Group, dug[idx].User, dug[idx].Group, dug[idx].Tout); err != nil {
+			mpC = mpC.reject(Group, dug[idx].User, dug[idx].Group, err)
+			continue
 		}
+		e := dug[idx]
+		e.Tout = copyTout(e.Tout)
+		mpC.entries = append(mpC.entries, payload{
+			group: &e,
+		})
 	}
 	mpB = mp.Add(mpC)
 	return
@@ -234,13 +278,18 @@ func (mp UIDBuilder) Ungroup(dug []UserGroup) (mpB UIDBuilder) {
 		mpB = UIDBuilder{err: mp.err}
 		return
 	}
-	mpC := UIDBuilder{entries: make([]payload, len(dug))}
+	mpC := UIDBuilder{entries: make([]payload, 0, len(dug))}
 
 	for idx := range dug {
-		mpC.entries[idx] = payload{
-			ungroup_user:  &dug[idx].User,
-			ungroup_group: &dug[idx].Group,
+		if err := check(Ungroup, dug[idx].User, dug[idx].Group, nil); err != nil {
+			mpC = mpC.reject(Ungroup, dug[idx].User, dug[idx].Group, err)
+			continue
 		}
+		user, group := dug[idx].User, dug[idx].Group
+		mpC.entries = append(mpC.entries, payload{
+			ungroup_user:  &user,
+			ungroup_group: &group,
+		})
 	}
 	mpB = mp.Add(mpC)
 	return
@@ -256,7 +305,62 @@ func (mp UIDBuilder) UngroupUser(user, group string) (mpB UIDBuilder) {
 	return
 }
 
-// Add merges data from mpB builder into this builder
+// Members is used to add a list of group mapping entries into the User-ID payload. Each entry replaces the
+// full member list of its group in the device. If the same group is provided more than once only the last
+// list is kept
+func (mp UIDBuilder) Members(gm []GroupMembers) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	mpC := UIDBuilder{entries: make([]payload, 0, len(gm))}
+
+	for idx := range gm {
+		if err := checkGroup(gm[idx].Group); err != nil {
+			mpC = mpC.reject(Membership, gm[idx].Group, "", err)
+			continue
+		}
+		valid := true
+		for _, u := range gm[idx].Users {
+			if err := checkUser(u); err != nil {
+				mpC = mpC.reject(Membership, gm[idx].Group, u, err)
+				valid = false
+			}
+		}
+		if valid {
+			e := GroupMembers{Group: gm[idx].Group, Users: make([]string, len(gm[idx].Users))}
+			copy(e.Users, gm[idx].Users)
+			mpC.entries = append(mpC.entries, payload{
+				members: &e,
+			})
+		}
+	}
+	mpB = mp.Add(mpC)
+	return
+}
+
+// SetGroupMembers is used to add a single group mapping entry (the full list of members of group) into the
+// User-ID payload
+func (mp UIDBuilder) SetGroupMembers(group string, users []string) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	mpB = mp.Members([]GroupMembers{{Group: group, Users: users}})
+	return
+}
+
+// Collapse switches the builder into "collapse" mode. In this mode the final actions keep only the last
+// call for each ip-to-tag, user-to-ip or user-to-group pair. For instance, an UnregisterIP() followed by a
+// RegisterIP() for the same IP and tag results only in the registration and the Monitor is notified only
+// about it. By default both operations are sent and PAN-OS processing order applies
+func (mp UIDBuilder) Collapse() (mpB UIDBuilder) {
+	mpB = mp
+	mpB.collapse = true
+	return
+}
+
+// Add merges data from mpB builder into this builder. The resulting builder keeps the mode of this builder
 func (mp UIDBuilder) Add(mpB UIDBuilder) (mpC UIDBuilder) {
 	if mp.err != nil {
 		mpC = UIDBuilder{
@@ -264,217 +368,72 @@ func (mp UIDBuilder) Add(mpB UIDBuilder) (mpC UIDBuilder) {
 		}
 		return
 	}
-	mpC = UIDBuilder{
-		entries: append(mp.entries, mpB.entries...),
-	}
+	mpC = mp.append(mpB.entries, mpB.invalid)
 	return
 }
 
+// append returns a copy of the builder with entries and invalid appended to its lists. Builders branched
+// from the same parent share backing arrays, so the lists are appended in place only if no other builder has
+// appended beyond their length (copy-on-write, see claim())
+func (mp UIDBuilder) append(entries []payload, invalid []EntryError) (mpB UIDBuilder) {
+	mpB = mp
+	var max int
+	n := len(mp.entries)
+	max, mpB.entriesTip = claim(mp.entriesTip, n, cap(mp.entries), len(entries))
+	mpB.entries = append(mp.entries[:n:max], entries...)
+	n = len(mp.invalid)
+	max, mpB.invalidTip = claim(mp.invalidTip, n, cap(mp.invalid), len(invalid))
+	mpB.invalid = append(mp.invalid[:n:max], invalid...)
+	return
+}
+
+// claim decides whether k elements can be appended in place to a list of length n and capacity c whose
+// backing array may be shared with other builders. The tip records the length claimed so far on the array
+// and it is updated atomically so branches can be used from different goroutines. It returns the capacity
+// the list can keep (n if the claim fails, which makes append() copy it into a new array) and the tip of
+// the resulting array
+func claim(tip *int64, n, c, k int) (max int, newTip *int64) {
+	if k == 0 || (tip != nil && n+k <= c && atomic.CompareAndSwapInt64(tip, int64(n), int64(n+k))) {
+		return c, tip
+	}
+	t := int64(n + k)
+	return n, &t
+}
+
+// copyTout returns a pointer to a copy of the timeout so the builder does not depend on caller's variables
+func copyTout(tout *uint) *uint {
+	if tout == nil {
+		return nil
+	}
+	t := *tout
+	return &t
+}
+
 /*
 Payload is a final action. It merges all accumulated data into a PAN-OS XML
 User-ID API payload
 
 If a variable implementing the Monitor interface is provided then a log entry
 will be issued to it for every entry in the payload. Order of log entries will
-be unregister > unregister-user > logout > login > register-user > register
+be unregister > unregister-user > logout > login > groups > register-user > register
+
+Group mapping entries (see Members()) are reported with the Membership operation,
+the group as subject and a log entry with an empty value, which marks the start of
+the member list of the group (previous members are discarded), followed by one log
+entry per user. Monitors implementing the GroupMonitor interface get a single
+LogMembers() call per group instead.
+
+In "collapse" mode (see Collapse()) only the last operation for each pair is
+included in the payload and reported to the Monitor
+
+The payload is deterministic: entries in each section are sorted by subject (IP,
+user or group) and their tags (or IPs) by value. Log entries follow the same order
 */
 func (mp UIDBuilder) Payload(m Monitor) (p *x.UIDMsgPayload, err error) {
-	if mp.err != nil {
-		return nil, mp.err
-	}
-	size := len(mp.entries)
-	reg := make(map[string]map[string]*uint, size)     // IP.Tag.Tout
-	unreg := make(map[string]map[string]interface{})   // IP.Tag
-	login := make(map[string]map[string]*uint, size)   // User.IP.Tout
-	logout := make(map[string]map[string]interface{})  // User.IP
-	group := make(map[string]map[string]*uint, size)   // User.Group.Tout
-	ungroup := make(map[string]map[string]interface{}) // User.Group
-	for _, e := range mp.entries {
-		if e.unregister_ip != nil && e.unregister_tag != nil {
-			if unrege, exists := unreg[*e.unregister_ip]; exists {
-				unrege[*e.unregister_tag] = nil
-			} else {
-				unreg[*e.unregister_ip] = map[string]interface{}{*e.unregister_tag: nil}
-			}
-		}
-		if e.ungroup_user != nil && e.ungroup_group != nil {
-			if ungrpe, exists := ungroup[*e.ungroup_user]; exists {
-				ungrpe[*e.ungroup_group] = nil
-			} else {
-				ungroup[*e.ungroup_user] = map[string]interface{}{*e.ungroup_group: nil}
-			}
-		}
-		if e.logout_ip != nil && e.logout_user != nil {
-			if logoute, exists := logout[*e.logout_user]; exists {
-				logoute[*e.logout_ip] = nil
-			} else {
-				logout[*e.logout_user] = map[string]interface{}{*e.logout_ip: nil}
-			}
-		}
-		if e.login != nil {
-			if loge, exists := login[e.login.User]; exists {
-				loge[e.login.IP] = e.login.Tout
-			} else {
-				login[e.login.User] = map[string]*uint{e.login.IP: e.login.Tout}
-			}
-		}
-		if e.group != nil {
-			if grpe, exists := group[e.group.User]; exists {
-				grpe[e.group.Group] = e.group.Tout
-			} else {
-				group[e.group.User] = map[string]*uint{e.group.Group: e.group.Tout}
-			}
-		}
-		if e.register != nil {
-			if rege, exists := reg[e.register.IP]; exists {
-				rege[e.register.Tag] = e.register.Tout
-			} else {
-				reg[e.register.IP] = map[string]*uint{e.register.Tag: e.register.Tout}
-			}
-		}
-	}
-	p = &x.UIDMsgPayload{}
-	if len(unreg) > 0 {
-		p.Unregister = &x.UIDMsgPldDAGRegUnreg{
-			Entry: make([]x.UIDMsgPldDAGEntry, len(unreg)),
-		}
-		entryidx := 0
-		for ip, tagmap := range unreg {
-			dagentry := x.UIDMsgPldDAGEntry{
-				IP: ip,
-				Tag: x.UIDMsgPldDxGEntryTag{
-					Member: make([]x.UIDMsgPldDxGEnrtryTagMember, len(tagmap)),
-				},
-			}
-			tagidx := 0
-			for tag := range tagmap {
-				member := x.UIDMsgPldDxGEnrtryTagMember{
-					Member: tag,
-				}
-				dagentry.Tag.Member[tagidx] = member
-				tagidx++
-				mp.log(m, Unregister, ip, tag, nil)
-			}
-			p.Unregister.Entry[entryidx] = dagentry
-			entryidx++
-		}
-	}
-	if len(ungroup) > 0 {
-		p.UnregisterUser = &x.UIDMsgPldDUGRegUnreg{
-			Entry: make([]x.UIDMsgPldDUGEntry, len(ungroup)),
-		}
-		entryidx := 0
-		for user, groupmap := range ungroup {
-			dugentry := x.UIDMsgPldDUGEntry{
-				User: user,
-				Tag: x.UIDMsgPldDxGEntryTag{
-					Member: make([]x.UIDMsgPldDxGEnrtryTagMember, len(groupmap)),
-				},
-			}
-			tagidx := 0
-			for tag := range groupmap {
-				member := x.UIDMsgPldDxGEnrtryTagMember{
-					Member: tag,
-				}
-				dugentry.Tag.Member[tagidx] = member
-				tagidx++
-				mp.log(m, Ungroup, user, tag, nil)
-			}
-			p.UnregisterUser.Entry[entryidx] = dugentry
-			entryidx++
-		}
-	}
-	if len(logout) > 0 {
-		p.Logout = &x.UIDMsgPldLogInOut{
-			Entry: make([]x.UIDMsgPldLogEntry, 0, len(logout)*2),
-		}
-		for user, ipmap := range logout {
-			for ip := range ipmap {
-				logoutentry := x.UIDMsgPldLogEntry{
-					Name: user,
-					IP:   ip,
-				}
-				p.Logout.Entry = append(p.Logout.Entry, logoutentry)
-				mp.log(m, Logout, user, ip, nil)
-			}
-		}
-	}
-	if len(login) > 0 {
-		p.Login = &x.UIDMsgPldLogInOut{
-			Entry: make([]x.UIDMsgPldLogEntry, 0, len(login)*2),
-		}
-		for user, ipmap := range login {
-			for ip, tout := range ipmap {
-				loginentry := x.UIDMsgPldLogEntry{
-					Name: user,
-					IP:   ip,
-				}
-				if tout != nil {
-					toutstr := fmt.Sprint(*tout)
-					loginentry.Timeout = &toutstr
-				}
-				p.Login.Entry = append(p.Login.Entry, loginentry)
-				mp.log(m, Login, user, ip, tout)
-			}
-		}
-	}
-	if len(group) > 0 {
-		p.RegisterUser = &x.UIDMsgPldDUGRegUnreg{
-			Entry: make([]x.UIDMsgPldDUGEntry, len(group)),
-		}
-		entryidx := 0
-		for user, grp := range group {
-			dugentry := x.UIDMsgPldDUGEntry{
-				User: user,
-				Tag: x.UIDMsgPldDxGEntryTag{
-					Member: make([]x.UIDMsgPldDxGEnrtryTagMember, len(grp)),
-				},
-			}
-			tagidx := 0
-			for tag, tout := range grp {
-				member := x.UIDMsgPldDxGEnrtryTagMember{
-					Member: tag,
-				}
-				if tout != nil {
-					toutstr := fmt.Sprint(*tout)
-					member.Timeout = &toutstr
-				}
-				dugentry.Tag.Member[tagidx] = member
-				tagidx++
-				mp.log(m, Group, user, tag, tout)
-			}
-			p.RegisterUser.Entry[entryidx] = dugentry
-			entryidx++
-		}
-	}
-	if len(reg) > 0 {
-		p.Register = &x.UIDMsgPldDAGRegUnreg{
-			Entry: make([]x.UIDMsgPldDAGEntry, len(reg)),
-		}
-		entryidx := 0
-		for ip, tag := range reg {
-			dagentry := x.UIDMsgPldDAGEntry{
-				IP: ip,
-				Tag: x.UIDMsgPldDxGEntryTag{
-					Member: make([]x.UIDMsgPldDxGEnrtryTagMember, len(tag)),
-				},
-			}
-			tagidx := 0
-			for tag, tout := range tag {
-				member := x.UIDMsgPldDxGEnrtryTagMember{
-					Member: tag,
-				}
-				if tout != nil {
-					toutstr := fmt.Sprint(*tout)
-					member.Timeout = &toutstr
-				}
-				dagentry.Tag.Member[tagidx] = member
-				tagidx++
-				mp.log(m, Register, ip, tag, tout)
-			}
-			p.Register.Entry[entryidx] = dagentry
-			entryidx++
-		}
+	var s *sections
+	if s, err = mp.sections(); err == nil {
+		s.log(mp, m)
+		p = s.payload()
 	}
 	return
 }
@@ -485,7 +444,7 @@ use PAN-OS XML User-ID API message
 
 If a variable implementing the Monitor interface is provided then a log entry
 will be issued to it for every entry in the payload. Order of log entries will
-be unregister > unregister-user > logout > login > register-user > register
+be unregister > unregister-user > logout > login > groups > register-user > register
 */
 func (mp UIDBuilder) UIDMessage(m Monitor) (u *x.UIDMessage, err error) {
 	var p *x.UIDMsgPayload
@@ -502,11 +461,12 @@ func (mp UIDBuilder) UIDMessage(m Monitor) (u *x.UIDMessage, err error) {
 /*
 Push is a final action. It merges all accumulated data into a ready-to use
 PAN-OS XML User-ID API message and sends it to the device leveraging a
-provided http.Client.
+provided http.Client. The API key is sent in the form body, use PushTarget() to
+send it in the X-PAN-KEY header instead.
 
 If a variable implementing the Monitor interface is provided then a log entry
 will be issued to it for every entry in the payload. Order of log entries will
-be unregister > unregister-user > logout > login > register-user > register
+be unregister > unregister-user > logout > login > groups > register-user > register
 */
 func (mp UIDBuilder) Push(
 	hostport, apikey string,
@@ -514,30 +474,56 @@ func (mp UIDBuilder) Push(
 	m Monitor) (resp *http.Response, err error) {
 	var u *x.UIDMessage
 	if u, err = mp.UIDMessage(m); err == nil {
-		target := "https://" + hostport + "/api/?"
-		values := url.Values{
-			"key":  []string{apikey},
-			"type": []string{"user-id"},
-		}
-		var cmd []byte
-		if cmd, err = xml.Marshal(u); err == nil {
-			values["cmd"] = []string{string(cmd)}
-			var req *http.Request
-			if req, err = http.NewRequest(http.MethodPost, target, strings.NewReader(values.Encode())); err == nil {
-				req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-				resp, err = c.Do(req)
-			}
+		resp, err = push(Target{HostPort: hostport, APIKey: apikey}, u, c)
+	}
+	return
+}
+
+func push(t Target, u *x.UIDMessage, c Client) (resp *http.Response, err error) {
+	var cmd []byte
+	if cmd, err = xml.Marshal(u); err == nil {
+		var req *http.Request
+		if req, err = t.newRequest(context.Background(), strings.NewReader(t.encodeForm(cmd))); err == nil {
+			resp, err = c.Do(req)
+			err = Redact(err, t.APIKey)
 		}
 	}
 	return
 }
 
+func newRequest(ctx context.Context, hostport string, body io.Reader) (req *http.Request, err error) {
+	target := "https://" + hostport + "/api/?"
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, target, body); err == nil {
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return
+}
+
 func (mp UIDBuilder) log(m Monitor, op Operation, subject string, value string, tout *uint) {
 	if m != nil {
 		m.Log(op, subject, value, tout)
 	}
 }
 
+func (mp UIDBuilder) logPersistent(m Monitor, ip, tag string, tout *uint) {
+	if pm, ok := m.(PersistentMonitor); ok {
+		pm.LogPersistent(ip, tag, tout)
+	} else {
+		mp.log(m, Register, ip, tag, tout)
+	}
+}
+
+func (mp UIDBuilder) logMembers(m Monitor, gm GroupMembers) {
+	if gmon, ok := m.(GroupMonitor); ok {
+		gmon.LogMembers(gm.Group, append([]string(nil), gm.Users...))
+		return
+	}
+	mp.log(m, Membership, gm.Group, "", nil)
+	for _, user := range gm.Users {
+		mp.log(m, Membership, gm.Group, user, nil)
+	}
+}
+
 func ptrstr2uint(in *string) (out *uint, err error) {
 	if in != nil {
 		var ui uint64
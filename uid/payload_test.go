@@ -635,3 +635,185 @@ func TestFromPayloadRegisterT(t *testing.T) {
 	}
 	t.Error(err)
 }
+
+type logEntry struct {
+	op             uid.Operation
+	subject, value string
+}
+
+type recorder []logEntry
+
+func (r *recorder) Log(op uid.Operation, subject, value string, tout *uint) {
+	*r = append(*r, logEntry{op, subject, value})
+}
+
+func TestCollapse(t *testing.T) {
+	mp := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		UnregisterIP("1.1.1.1", "foo").
+		UnregisterIP("2.2.2.2", "foo").
+		RegisterIP("2.2.2.2", "foo", nil).
+		LoginUser("foo@test.local", "1.1.1.1", nil).
+		LogoutUser("foo@test.local", "1.1.1.1").
+		UngroupUser("foo@test.local", "admin").
+		GroupUser("foo@test.local", "admin", nil).
+		Collapse()
+	var err error
+	var p *x.UIDMsgPayload
+	r := &recorder{}
+	if p, err = mp.Payload(r); err == nil {
+		switch {
+		case p.Register == nil, len(p.Register.Entry) != 1, p.Register.Entry[0].IP != "2.2.2.2",
+			p.Unregister == nil, len(p.Unregister.Entry) != 1, p.Unregister.Entry[0].IP != "1.1.1.1",
+			p.Login != nil, p.Logout == nil, len(p.Logout.Entry) != 1,
+			p.UnregisterUser != nil, p.RegisterUser == nil, len(p.RegisterUser.Entry) != 1:
+			err = errors.New("recovery error")
+		case len(*r) != 4:
+			err = errors.New("unexpected monitor log")
+		default:
+			return
+		}
+	}
+	t.Error(err)
+}
+
+func TestCollapseDefault(t *testing.T) {
+	mp := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		UnregisterIP("1.1.1.1", "foo")
+	r := &recorder{}
+	if p, err := mp.Payload(r); err != nil || p.Register == nil || p.Unregister == nil || len(*r) != 2 {
+		t.Error("both operations expected when not in collapse mode")
+	}
+	if p, err := mp.Collapse().Add(uid.NewUIDBuilder().RegisterIP("1.1.1.1", "foo", nil)).Payload(nil); err != nil ||
+		p.Register == nil || p.Unregister != nil {
+		t.Error("collapse mode lost after Add()")
+	}
+}
+
+func TestPersistentRegister(t *testing.T) {
+	mp := uid.NewUIDBuilder().
+		RegisterIPPersistent("1.1.1.1", "foo", nil).
+		RegisterIP("1.1.1.1", "bar", nil)
+	var err error
+	var p *x.UIDMsgPayload
+	var b []byte
+	if p, err = mp.Payload(nil); err == nil {
+		if b, err = xml.Marshal(p); err == nil {
+			p = &x.UIDMsgPayload{}
+			if err = xml.Unmarshal(b, p); err == nil {
+				if p, err = uid.NewBuilderFromPayload(p).Payload(nil); err == nil {
+					switch {
+					case p.Register == nil, len(p.Register.Entry) != 2:
+						err = errors.New("nil unmarshal")
+					case p.Register.Entry[0].Persistent != "",
+						p.Register.Entry[0].Tag.Member[0].Member != "bar",
+						p.Register.Entry[1].Persistent != "1",
+						p.Register.Entry[1].Tag.Member[0].Member != "foo":
+						err = errors.New("recovery error")
+					default:
+						return
+					}
+				}
+			}
+		}
+	}
+	t.Error(err)
+}
+
+func TestGroupMembers(t *testing.T) {
+	mp := uid.NewUIDBuilder().
+		SetGroupMembers("admin", []string{"foo@test.local"}).
+		Members([]uid.GroupMembers{
+			{Group: "admin", Users: []string{"foo@test.local", "bar@test.local"}},
+			{Group: "empty"},
+		})
+	var err error
+	var p *x.UIDMsgPayload
+	var b []byte
+	r := &recorder{}
+	if p, err = mp.Payload(r); err == nil {
+		if b, err = xml.Marshal(p); err == nil {
+			p = &x.UIDMsgPayload{}
+			if err = xml.Unmarshal(b, p); err == nil {
+				if p, err = uid.NewBuilderFromPayload(p).Payload(nil); err == nil {
+					members := map[string]int{}
+					if p.Groups != nil {
+						for _, e := range p.Groups.Entry {
+							members[e.Name] = len(e.Members.Entry)
+						}
+					}
+					switch {
+					case p.Groups == nil, len(p.Groups.Entry) != 2:
+						err = errors.New("nil unmarshal")
+					case members["admin"] != 2, members["empty"] != 0:
+						err = errors.New("recovery error")
+					case len(*r) != 4, (*r)[0].op != uid.Membership, (*r)[0].value != "":
+						err = errors.New("unexpected monitor log")
+					default:
+						return
+					}
+				}
+			}
+		}
+	}
+	t.Error(err)
+}
+
+func TestGroupMembersInvalid(t *testing.T) {
+	if _, err := uid.NewUIDBuilder().SetGroupMembers("", nil).SetGroupMembers("admin", []string{""}).Payload(nil); err == nil {
+		t.Error("expected validation error")
+	} else if verr, ok := err.(*uid.ValidationError); !ok || len(verr.Entries) != 2 {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	mp := uid.NewUIDBuilder().
+		RegisterIP("2.2.2.2", "foo", nil).
+		RegisterIP("1.1.1.1", "foo", nil).
+		RegisterIP("1.1.1.1", "bar", nil).
+		LoginUser("foo@test.local", "2.2.2.2", nil).
+		LoginUser("bar@test.local", "1.1.1.1", nil).
+		LoginUser("foo@test.local", "1.1.1.1", nil)
+	first, err := mp.UIDMessage(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []byte
+	if expected, err = xml.Marshal(first); err != nil {
+		t.Fatal(err)
+	}
+	for idx := 0; idx < 20; idx++ {
+		r := &recorder{}
+		u, _ := mp.UIDMessage(r)
+		if got, _ := xml.Marshal(u); !bytes.Equal(got, expected) {
+			t.Fatalf("payload changed between runs:\n%s\n%s", expected, got)
+		}
+		log := []logEntry{
+			{uid.Login, "bar@test.local", "1.1.1.1"},
+			{uid.Login, "foo@test.local", "1.1.1.1"},
+			{uid.Login, "foo@test.local", "2.2.2.2"},
+			{uid.Register, "1.1.1.1", "bar"},
+			{uid.Register, "1.1.1.1", "foo"},
+			{uid.Register, "2.2.2.2", "foo"},
+		}
+		if len(*r) != len(log) {
+			t.Fatalf("unexpected monitor log %v", *r)
+		}
+		for pos, e := range log {
+			if (*r)[pos] != e {
+				t.Fatalf("unexpected monitor log %v", *r)
+			}
+		}
+	}
+}
+
+func BenchmarkPayload(b *testing.B) {
+	mp := benchBuilder(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		_, _ = mp.Payload(nil)
+	}
+}
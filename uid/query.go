@@ -0,0 +1,88 @@
+package uid
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	x "github.com/xhoms/panoslib/collection"
+)
+
+const (
+	cmdRegisteredIP   = "<show><object><registered-ip><all></all></registered-ip></object></show>"
+	cmdIPUserMapping  = "<show><user><ip-user-mapping><all></all></ip-user-mapping></user></show>"
+	cmdRegisteredUser = "<show><object><registered-user><all></all></registered-user></object></show>"
+)
+
+// op sends an operational command to the device described by t and parses the response into v
+func op(t Target, cmd string, c Client, v interface{}) (err error) {
+	values := t.values("op")
+	values["cmd"] = []string{cmd}
+	var req *http.Request
+	if req, err = t.newRequest(context.Background(), strings.NewReader(values.Encode())); err == nil {
+		var body []byte
+		if body, _, err = validate(c.Do(req)); err == nil {
+			err = xml.Unmarshal(body, v)
+		}
+	}
+	err = Redact(err, t.APIKey)
+	return
+}
+
+// QueryRegisteredIP returns the list of ip-to-tag entries currently registered in the device
+// ("show object registered-ip all" op command)
+func QueryRegisteredIP(hostport, apikey string, c Client) (r *x.RegisteredIPResult, err error) {
+	return QueryRegisteredIPTarget(Target{HostPort: hostport, APIKey: apikey}, c)
+}
+
+// QueryRegisteredIPTarget is like QueryRegisteredIP() but the device is described by a Target (Vsys is
+// ignored)
+func QueryRegisteredIPTarget(t Target, c Client) (r *x.RegisteredIPResult, err error) {
+	resp := &x.RegisteredIPResponse{}
+	if err = op(t, cmdRegisteredIP, c, resp); err == nil {
+		r = resp.Result
+		if r == nil {
+			r = &x.RegisteredIPResult{}
+		}
+	}
+	return
+}
+
+// QueryUserIPMapping returns the list of user-to-ip entries currently known by the device
+// ("show user ip-user-mapping all" op command)
+func QueryUserIPMapping(hostport, apikey string, c Client) (r *x.IPUserMappingResult, err error) {
+	return QueryUserIPMappingTarget(Target{HostPort: hostport, APIKey: apikey}, c)
+}
+
+// QueryUserIPMappingTarget is like QueryUserIPMapping() but the device is described by a Target (Vsys is
+// ignored)
+func QueryUserIPMappingTarget(t Target, c Client) (r *x.IPUserMappingResult, err error) {
+	resp := &x.IPUserMappingResponse{}
+	if err = op(t, cmdIPUserMapping, c, resp); err == nil {
+		r = resp.Result
+		if r == nil {
+			r = &x.IPUserMappingResult{}
+		}
+	}
+	return
+}
+
+// QueryRegisteredUser returns the list of user-to-group (DUG) entries currently registered in the device
+// ("show object registered-user all" op command)
+func QueryRegisteredUser(hostport, apikey string, c Client) (r *x.RegisteredUserResult, err error) {
+	return QueryRegisteredUserTarget(Target{HostPort: hostport, APIKey: apikey}, c)
+}
+
+// QueryRegisteredUserTarget is like QueryRegisteredUser() but the device is described by a Target (Vsys is
+// ignored)
+func QueryRegisteredUserTarget(t Target, c Client) (r *x.RegisteredUserResult, err error) {
+	resp := &x.RegisteredUserResponse{}
+	if err = op(t, cmdRegisteredUser, c, resp); err == nil {
+		r = resp.Result
+		if r == nil {
+			r = &x.RegisteredUserResult{}
+		}
+	}
+	return
+}
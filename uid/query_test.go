@@ -0,0 +1,126 @@
+package uid_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	x "github.com/xhoms/panoslib/collection"
+	"github.com/xhoms/panoslib/uid"
+)
+
+func TestQueryRegisteredIP(t *testing.T) {
+	var respBody client = `
+<response status="success">
+	<result>
+		<entry ip="1.1.1.1" from_agent="0" persistent="1">
+			<tag>
+				<member>foo</member>
+				<member>bar</member>
+			</tag>
+		</entry>
+		<entry ip="2.2.2.2" from_agent="0" persistent="0">
+			<tag>
+				<member>foo</member>
+			</tag>
+		</entry>
+		<count>2</count>
+	</result>
+</response>
+`
+	var err error
+	var r *x.RegisteredIPResult
+	if r, err = uid.QueryRegisteredIP("vm.test.local", "apikey", respBody); err == nil {
+		if r.Count == 2 && len(r.Entry) == 2 &&
+			r.Entry[0].IP == "1.1.1.1" && r.Entry[0].Persistent == "1" &&
+			len(r.Entry[0].Tag.Member) == 2 && r.Entry[1].Tag.Member[0].Member == "foo" {
+			return
+		}
+		err = errors.New("recovery error")
+	}
+	t.Error(err)
+}
+
+func TestQueryUserIPMapping(t *testing.T) {
+	var respBody client = `
+<response status="success">
+	<result>
+		<entry>
+			<ip>1.1.1.1</ip>
+			<vsys>vsys1</vsys>
+			<type>XMLAPI</type>
+			<user>foo@test.local</user>
+			<idle_timeout>3540</idle_timeout>
+			<timeout>3540</timeout>
+			<maxtimeout>3540</maxtimeout>
+		</entry>
+		<count>1</count>
+	</result>
+</response>
+`
+	var err error
+	var r *x.IPUserMappingResult
+	if r, err = uid.QueryUserIPMapping("vm.test.local", "apikey", respBody); err == nil {
+		if r.Count == 1 && len(r.Entry) == 1 &&
+			r.Entry[0].IP == "1.1.1.1" && r.Entry[0].User == "foo@test.local" &&
+			r.Entry[0].Type == "XMLAPI" && r.Entry[0].Timeout == "3540" {
+			return
+		}
+		err = errors.New("recovery error")
+	}
+	t.Error(err)
+}
+
+func TestQueryRegisteredUser(t *testing.T) {
+	var respBody client = `
+<response status="success">
+	<result>
+		<entry user="foo@test.local">
+			<tag>
+				<member>admin</member>
+			</tag>
+		</entry>
+		<count>1</count>
+	</result>
+</response>
+`
+	var err error
+	var r *x.RegisteredUserResult
+	if r, err = uid.QueryRegisteredUser("vm.test.local", "apikey", respBody); err == nil {
+		if r.Count == 1 && len(r.Entry) == 1 &&
+			r.Entry[0].User == "foo@test.local" && r.Entry[0].Tag.Member[0].Member == "admin" {
+			return
+		}
+		err = errors.New("recovery error")
+	}
+	t.Error(err)
+}
+
+func TestQueryErr(t *testing.T) {
+	var respBody client = `<response status="error"><msg><line>invalid command</line></msg></response>`
+	if _, err := uid.QueryRegisteredIP("vm.test.local", "apikey", respBody); err == nil {
+		t.Error("expected error")
+	}
+}
+
+// routeClient replies with the body whose key is contained in the request cmd
+type routeClient map[string]string
+
+func (c routeClient) Do(req *http.Request) (resp *http.Response, err error) {
+	if err = req.ParseForm(); err == nil {
+		body := `<response status="error"><msg><line>unknown command</line></msg></response>`
+		for k, v := range c {
+			if strings.Contains(req.PostForm.Get("cmd"), k) {
+				body = v
+			}
+		}
+		resp = &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+			StatusCode: http.StatusOK,
+		}
+	}
+	return
+}
@@ -0,0 +1,238 @@
+package uid
+
+import (
+	"strconv"
+
+	x "github.com/xhoms/panoslib/collection"
+)
+
+// Snapshot is a static implementation of the State interface
+type Snapshot struct {
+	IPTag     []IPTag
+	UserMap   []UserMap
+	UserGroup []UserGroup
+}
+
+// IPTags returns the list of ip-to-tag entries in the snapshot
+func (s *Snapshot) IPTags() []IPTag {
+	return s.IPTag
+}
+
+// UserMaps returns the list of user-to-ip entries in the snapshot
+func (s *Snapshot) UserMaps() []UserMap {
+	return s.UserMap
+}
+
+// UserGroups returns the list of user-to-group entries in the snapshot
+func (s *Snapshot) UserGroups() []UserGroup {
+	return s.UserGroup
+}
+
+// QueryState returns a Snapshot of the User-ID entries currently active in the device. It combines the
+// results of QueryRegisteredIP(), QueryUserIPMapping() and QueryRegisteredUser(). Timeouts are converted to
+// the units used by the UIDBuilder (seconds for tags, minutes for user mappings)
+func QueryState(hostport, apikey string, c Client) (s *Snapshot, err error) {
+	return QueryStateTarget(Target{HostPort: hostport, APIKey: apikey}, c)
+}
+
+// QueryStateTarget is like QueryState() but the device is described by a Target (Vsys is ignored)
+func QueryStateTarget(t Target, c Client) (s *Snapshot, err error) {
+	var regip *x.RegisteredIPResult
+	var ipuser *x.IPUserMappingResult
+	var reguser *x.RegisteredUserResult
+	if regip, err = QueryRegisteredIPTarget(t, c); err != nil {
+		return
+	}
+	if ipuser, err = QueryUserIPMappingTarget(t, c); err != nil {
+		return
+	}
+	if reguser, err = QueryRegisteredUserTarget(t, c); err != nil {
+		return
+	}
+	s = &Snapshot{}
+	for _, e := range regip.Entry {
+		for _, t := range e.Tag.Member {
+			tout, _ := ptrstr2uint(t.Timeout)
+			s.IPTag = append(s.IPTag, IPTag{IP: e.IP, Tag: t.Member, Tout: tout, Persistent: e.Persistent == "1"})
+		}
+	}
+	for _, e := range ipuser.Entry {
+		um := UserMap{IP: e.IP, User: e.User}
+		if secs, perr := strconv.ParseUint(e.Timeout, 10, 32); perr == nil {
+			mins := uint((secs + 59) / 60)
+			um.Tout = &mins
+		}
+		s.UserMap = append(s.UserMap, um)
+	}
+	for _, e := range reguser.Entry {
+		for _, t := range e.Tag.Member {
+			tout, _ := ptrstr2uint(t.Timeout)
+			s.UserGroup = append(s.UserGroup, UserGroup{User: e.User, Group: t.Member, Tout: tout})
+		}
+	}
+	return
+}
+
+/*
+Reconcile returns a UIDBuilder with the operations needed to move the device from
+the actual state to the desired one:
+
+  - ip-to-tag entries only in desired are registered and the ones only in actual are unregistered
+  - user-to-ip entries only in desired are logged in and the ones only in actual are logged out
+  - user-to-group entries only in desired are grouped and the ones only in actual are ungrouped
+
+Entries present in both states are left untouched (timeouts are not compared). Any of
+the states can be nil (meaning empty)
+*/
+func Reconcile(desired, actual State) (mp UIDBuilder) {
+	var dtag, atag []IPTag
+	var duser, auser []UserMap
+	var dgroup, agroup []UserGroup
+	if desired != nil {
+		dtag, duser, dgroup = desired.IPTags(), desired.UserMaps(), desired.UserGroups()
+	}
+	if actual != nil {
+		atag, auser, agroup = actual.IPTags(), actual.UserMaps(), actual.UserGroups()
+	}
+	mp = NewUIDBuilder()
+
+	dtagset := make(map[[2]string]bool, len(dtag))
+	for _, e := range dtag {
+		dtagset[[2]string{e.IP, e.Tag}] = true
+	}
+	atagset := make(map[[2]string]bool, len(atag))
+	for _, e := range atag {
+		k := [2]string{e.IP, e.Tag}
+		if !dtagset[k] && !atagset[k] {
+			mp = mp.UnregisterIP(e.IP, e.Tag)
+		}
+		atagset[k] = true
+	}
+	for _, e := range dtag {
+		if !atagset[[2]string{e.IP, e.Tag}] {
+			mp = mp.Register([]IPTag{e})
+		}
+	}
+
+	duserset := make(map[[2]string]bool, len(duser))
+	for _, e := range duser {
+		duserset[[2]string{e.User, e.IP}] = true
+	}
+	auserset := make(map[[2]string]bool, len(auser))
+	for _, e := range auser {
+		k := [2]string{e.User, e.IP}
+		if !duserset[k] && !auserset[k] {
+			mp = mp.LogoutUser(e.User, e.IP)
+		}
+		auserset[k] = true
+	}
+	for _, e := range duser {
+		if !auserset[[2]string{e.User, e.IP}] {
+			mp = mp.LoginUser(e.User, e.IP, e.Tout)
+		}
+	}
+
+	dgroupset := make(map[[2]string]bool, len(dgroup))
+	for _, e := range dgroup {
+		dgroupset[[2]string{e.User, e.Group}] = true
+	}
+	agroupset := make(map[[2]string]bool, len(agroup))
+	for _, e := range agroup {
+		k := [2]string{e.User, e.Group}
+		if !dgroupset[k] && !agroupset[k] {
+			mp = mp.UngroupUser(e.User, e.Group)
+		}
+		agroupset[k] = true
+	}
+	for _, e := range dgroup {
+		if !agroupset[[2]string{e.User, e.Group}] {
+			mp = mp.GroupUser(e.User, e.Group, e.Tout)
+		}
+	}
+	return
+}
+
+/*
+UnregisterTag adds unregister entries for all the ip-to-tag entries in s with the
+provided tag (i.e. remove the tag from all IP's). The PAN-OS XML User-ID API requires
+explicit ip-to-tag pairs so a State (like a MemMonitor or a Snapshot built with
+QueryState()) is used as knowledge source. A nil State adds no entries
+*/
+func (mp UIDBuilder) UnregisterTag(tag string, s State) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	mpB = mp.Unregister(matchTags(s, func(e IPTag) bool { return e.Tag == tag }))
+	return
+}
+
+// UnregisterAllTagsForIP adds unregister entries for all the ip-to-tag entries in s for the provided IP (see
+// UnregisterTag())
+func (mp UIDBuilder) UnregisterAllTagsForIP(ip string, s State) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	mpB = mp.Unregister(matchTags(s, func(e IPTag) bool { return e.IP == ip }))
+	return
+}
+
+// LogoutAllForUser adds logout entries for all the user-to-ip entries in s for the provided user (see
+// UnregisterTag())
+func (mp UIDBuilder) LogoutAllForUser(user string, s State) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	uid := []UserMap{}
+	seen := map[string]bool{}
+	if s != nil {
+		for _, e := range s.UserMaps() {
+			if e.User == user && !seen[e.IP] {
+				uid = append(uid, UserMap{User: e.User, IP: e.IP})
+				seen[e.IP] = true
+			}
+		}
+	}
+	mpB = mp.Logout(uid)
+	return
+}
+
+// UngroupAllForUser adds unregister-user entries for all the user-to-group entries in s for the provided user
+// (see UnregisterTag())
+func (mp UIDBuilder) UngroupAllForUser(user string, s State) (mpB UIDBuilder) {
+	if mp.err != nil {
+		mpB = UIDBuilder{err: mp.err}
+		return
+	}
+	dug := []UserGroup{}
+	seen := map[string]bool{}
+	if s != nil {
+		for _, e := range s.UserGroups() {
+			if e.User == user && !seen[e.Group] {
+				dug = append(dug, UserGroup{User: e.User, Group: e.Group})
+				seen[e.Group] = true
+			}
+		}
+	}
+	mpB = mp.Ungroup(dug)
+	return
+}
+
+// matchTags returns the (deduplicated) ip-to-tag pairs in s that match f
+func matchTags(s State, f func(IPTag) bool) (dag []IPTag) {
+	dag = []IPTag{}
+	if s == nil {
+		return
+	}
+	seen := map[[2]string]bool{}
+	for _, e := range s.IPTags() {
+		k := [2]string{e.IP, e.Tag}
+		if f(e) && !seen[k] {
+			dag = append(dag, IPTag{IP: e.IP, Tag: e.Tag})
+			seen[k] = true
+		}
+	}
+	return
+}
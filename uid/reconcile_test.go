@@ -0,0 +1,95 @@
+package uid_test
+
+import (
+	"errors"
+	"testing"
+
+	x "github.com/xhoms/panoslib/collection"
+	"github.com/xhoms/panoslib/uid"
+)
+
+func TestReconcile(t *testing.T) {
+	desired := &uid.Snapshot{
+		IPTag:     []uid.IPTag{{IP: "1.1.1.1", Tag: "foo"}, {IP: "2.2.2.2", Tag: "foo"}},
+		UserMap:   []uid.UserMap{{User: "foo@test.local", IP: "1.1.1.1"}},
+		UserGroup: []uid.UserGroup{{User: "foo@test.local", Group: "admin"}},
+	}
+	actual := &uid.Snapshot{
+		IPTag:     []uid.IPTag{{IP: "1.1.1.1", Tag: "foo"}, {IP: "3.3.3.3", Tag: "foo"}},
+		UserMap:   []uid.UserMap{{User: "bar@test.local", IP: "1.1.1.1"}},
+		UserGroup: []uid.UserGroup{{User: "foo@test.local", Group: "admin"}, {User: "foo@test.local", Group: "devops"}},
+	}
+	var err error
+	var p *x.UIDMsgPayload
+	if p, err = uid.Reconcile(desired, actual).Payload(nil); err == nil {
+		switch {
+		case p.Register == nil, len(p.Register.Entry) != 1, p.Register.Entry[0].IP != "2.2.2.2",
+			p.Unregister == nil, len(p.Unregister.Entry) != 1, p.Unregister.Entry[0].IP != "3.3.3.3",
+			p.Login == nil, len(p.Login.Entry) != 1, p.Login.Entry[0].Name != "foo@test.local",
+			p.Logout == nil, len(p.Logout.Entry) != 1, p.Logout.Entry[0].Name != "bar@test.local",
+			p.RegisterUser != nil,
+			p.UnregisterUser == nil, p.UnregisterUser.Entry[0].Tag.Member[0].Member != "devops":
+			err = errors.New("recovery error")
+		default:
+			return
+		}
+	}
+	t.Error(err)
+}
+
+func TestReconcileInSync(t *testing.T) {
+	s := &uid.Snapshot{IPTag: []uid.IPTag{{IP: "1.1.1.1", Tag: "foo"}}}
+	if p, err := uid.Reconcile(s, s).Payload(nil); err != nil ||
+		p.Register != nil || p.Unregister != nil {
+		t.Error("no operations expected for states in sync")
+	}
+}
+
+func TestQueryState(t *testing.T) {
+	c := routeClient{
+		"registered-ip":   `<response status="success"><result><entry ip="1.1.1.1" persistent="1"><tag><member>foo</member></tag></entry></result></response>`,
+		"ip-user-mapping": `<response status="success"><result><entry><ip>1.1.1.1</ip><user>foo@test.local</user><timeout>90</timeout></entry></result></response>`,
+		"registered-user": `<response status="success"><result><entry user="foo@test.local"><tag><member>admin</member></tag></entry></result></response>`,
+	}
+	var err error
+	var s *uid.Snapshot
+	if s, err = uid.QueryState("vm.test.local", "apikey", c); err == nil {
+		if len(s.IPTag) == 1 && s.IPTag[0].Persistent &&
+			len(s.UserMap) == 1 && s.UserMap[0].Tout != nil && *s.UserMap[0].Tout == 2 &&
+			len(s.UserGroup) == 1 && s.UserGroup[0].Group == "admin" {
+			return
+		}
+		err = errors.New("recovery error")
+	}
+	t.Error(err)
+}
+
+func TestRemoveAll(t *testing.T) {
+	s := &uid.Snapshot{
+		IPTag: []uid.IPTag{{IP: "1.1.1.1", Tag: "quarantine"}, {IP: "1.1.1.1", Tag: "foo"},
+			{IP: "2.2.2.2", Tag: "quarantine"}, {IP: "2.2.2.2", Tag: "quarantine"}},
+		UserMap:   []uid.UserMap{{User: "foo@test.local", IP: "1.1.1.1"}, {User: "foo@test.local", IP: "2.2.2.2"}, {User: "bar@test.local", IP: "3.3.3.3"}},
+		UserGroup: []uid.UserGroup{{User: "foo@test.local", Group: "admin"}, {User: "bar@test.local", Group: "admin"}},
+	}
+	mp := uid.NewUIDBuilder().
+		UnregisterTag("quarantine", s).
+		UnregisterAllTagsForIP("1.1.1.1", s).
+		LogoutAllForUser("foo@test.local", s).
+		UngroupAllForUser("foo@test.local", s).
+		UnregisterTag("unknown", nil)
+	stats := mp.Stats()
+	if stats[uid.Unregister] != 4 || stats[uid.Logout] != 2 || stats[uid.Ungroup] != 1 || mp.Len() != 7 {
+		t.Fatalf("unexpected entries %v", stats)
+	}
+	var err error
+	var p *x.UIDMsgPayload
+	if p, err = mp.Payload(nil); err == nil {
+		if len(p.Unregister.Entry) == 2 && len(p.Unregister.Entry[0].Tag.Member) == 2 &&
+			len(p.Logout.Entry) == 2 && p.Logout.Entry[1].IP == "2.2.2.2" &&
+			len(p.UnregisterUser.Entry) == 1 && p.UnregisterUser.Entry[0].User == "foo@test.local" {
+			return
+		}
+		err = errors.New("recovery error")
+	}
+	t.Error(err)
+}
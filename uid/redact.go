@@ -0,0 +1,64 @@
+package uid
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces secrets (API keys and passwords) in the messages produced by Redact()
+const Redacted = "[REDACTED]"
+
+// RedactString returns s with every occurrence of the provided secrets (either plain or query escaped)
+// replaced by Redacted. Empty secrets are ignored
+func RedactString(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, secret, Redacted)
+		if escaped := url.QueryEscape(secret); escaped != secret {
+			s = strings.ReplaceAll(s, escaped, Redacted)
+		}
+	}
+	return s
+}
+
+// redactedError keeps the original error available to errors.Is() and errors.As() while hiding the
+// secrets in its message
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// Redact returns an error whose message does not contain any of the provided secrets (see RedactString()).
+// *APIError and *PartialError values are returned as redacted copies so their type is preserved. Other
+// errors are wrapped only if their message contains a secret
+func Redact(err error, secrets ...string) error {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *APIError:
+		redacted := *e
+		redacted.Message = RedactString(e.Message, secrets...)
+		return &redacted
+	case *PartialError:
+		redacted := &PartialError{Status: e.Status, Entries: make([]EntryResult, len(e.Entries))}
+		for idx, entry := range e.Entries {
+			entry.Message = RedactString(entry.Message, secrets...)
+			redacted.Entries[idx] = entry
+		}
+		return redacted
+	}
+	if msg := RedactString(err.Error(), secrets...); msg != err.Error() {
+		return &redactedError{msg: msg, err: err}
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package uid_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/xhoms/panoslib/uid"
+)
+
+// headerClient records the X-PAN-KEY header and the form values of the last request
+type headerClient struct {
+	header, key string
+}
+
+func (c *headerClient) Do(req *http.Request) (resp *http.Response, err error) {
+	if err = req.ParseForm(); err == nil {
+		c.header = req.Header.Get("X-PAN-KEY")
+		c.key = req.PostForm.Get("key")
+		resp = response(http.StatusOK, successBody)
+	}
+	return
+}
+
+// leakyClient fails with an error message that includes the request body
+type leakyClient struct{}
+
+func (leakyClient) Do(req *http.Request) (resp *http.Response, err error) {
+	if err = req.ParseForm(); err == nil {
+		err = fmt.Errorf("connection reset while sending %v", req.PostForm.Encode())
+	}
+	return
+}
+
+func TestPushKeyHeader(t *testing.T) {
+	c := &headerClient{}
+	target := uid.Target{HostPort: "fw.test.local", APIKey: "s3cr3t/key=", KeyHeader: true}
+	resp, err := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		PushTarget(context.Background(), target, c, nil, nil)
+	if _, err = uid.Validate(resp, err); err == nil {
+		if c.header == "s3cr3t/key=" && c.key == "" {
+			return
+		}
+		err = fmt.Errorf("unexpected header %q and form key %q", c.header, c.key)
+	}
+	t.Error(err)
+}
+
+// keyClient replies to keygen requests with a key and to everything else with a success response. It
+// records the requests that carried the API key in the form body and the ones without the X-PAN-KEY header
+type keyClient struct {
+	requests, leaks, missing int
+}
+
+func (c *keyClient) Do(req *http.Request) (resp *http.Response, err error) {
+	if err = req.ParseForm(); err == nil {
+		if req.PostForm.Get("type") == "keygen" {
+			return response(http.StatusOK, `<response status="success"><result><key>s3cr3t</key></result></response>`), nil
+		}
+		c.requests++
+		if req.PostForm.Get("key") != "" {
+			c.leaks++
+		}
+		if req.Header.Get("X-PAN-KEY") != "s3cr3t" {
+			c.missing++
+		}
+		resp = response(http.StatusOK, successBody)
+	}
+	return
+}
+
+func TestKeyHeaderEverywhere(t *testing.T) {
+	c := &keyClient{}
+	target := uid.Target{HostPort: "fw.test.local", APIKey: "s3cr3t", KeyHeader: true}
+	mp := uid.NewUIDBuilder().RegisterIP("1.1.1.1", "foo", nil)
+	var err error
+	if _, err = mp.PushMessagesTarget(target, 1, 0, c, nil); err != nil {
+		t.Fatal(err)
+	}
+	b := uid.NewBatcherTarget(target, c, nil, uid.BatcherConfig{})
+	if err = b.Add(mp); err == nil {
+		err = b.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = uid.NewSessionTarget(target, "admin", "secret", c).Push(context.Background(), mp, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = uid.QueryStateTarget(target, c); err == nil {
+		if c.requests == 6 && c.leaks == 0 && c.missing == 0 {
+			return
+		}
+		err = fmt.Errorf("%v requests, %v with the key in the form, %v without header", c.requests, c.leaks, c.missing)
+	}
+	t.Error(err)
+}
+
+func TestPushRedacted(t *testing.T) {
+	target := uid.Target{HostPort: "fw.test.local", APIKey: "s3cr3t/key="}
+	_, err := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		PushTarget(context.Background(), target, leakyClient{}, nil, nil)
+	if err != nil {
+		if !strings.Contains(err.Error(), "s3cr3t") && strings.Contains(err.Error(), uid.Redacted) {
+			return
+		}
+		err = fmt.Errorf("key not redacted: %v", err)
+	} else {
+		err = errors.New("expected an error")
+	}
+	t.Error(err)
+}
+
+func TestRedactAPIError(t *testing.T) {
+	_, err := uid.Validate(response(http.StatusForbidden,
+		`<response status="error" code="403"><result><msg>Invalid key s3cr3t</msg></result></response>`), nil)
+	err = uid.Redact(err, "s3cr3t")
+	var aerr *uid.APIError
+	if errors.As(err, &aerr) {
+		if aerr.Message == "Invalid key "+uid.Redacted && aerr.IsAuth() {
+			return
+		}
+		err = fmt.Errorf("unexpected error details %+v", aerr)
+	}
+	t.Error(err)
+}
+
+func TestRedactWrapped(t *testing.T) {
+	err := uid.Redact(fmt.Errorf("key s3cr3t: %w", context.DeadlineExceeded), "s3cr3t", "")
+	if errors.Is(err, context.DeadlineExceeded) && err.Error() == "key "+uid.Redacted+": context deadline exceeded" {
+		return
+	}
+	t.Error(err)
+}
@@ -0,0 +1,277 @@
+package uid
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	x "github.com/xhoms/panoslib/collection"
+)
+
+// ErrorKind classifies the message PAN-OS attaches to a User-ID response entry
+type ErrorKind int
+
+const (
+	// KindNone means the entry carries no message
+	KindNone ErrorKind = iota
+	// KindUnknown is a message that could not be classified
+	KindUnknown
+	// KindAlreadyExists is a register operation for an existing entry (no-op)
+	KindAlreadyExists
+	// KindNotExist is an unregister operation for a non existing entry (no-op)
+	KindNotExist
+	// KindLimit means a device limit (i.e. max number of tags) was reached
+	KindLimit
+	// KindInvalid means the device rejected the entry as invalid
+	KindInvalid
+)
+
+func (k ErrorKind) String() (s string) {
+	switch k {
+	case KindNone:
+		s = "none"
+	case KindUnknown:
+		s = "unknown"
+	case KindAlreadyExists:
+		s = "already exists"
+	case KindNotExist:
+		s = "does not exist"
+	case KindLimit:
+		s = "limit reached"
+	case KindInvalid:
+		s = "invalid"
+	default:
+		s = fmt.Sprintf("ErrorKind(%d)", int(k))
+	}
+	return
+}
+
+// EntryResult is the outcome of a single entry as reported in a PAN-OS User-ID response. Subject is the IP
+// (register / unregister) or the user (register-user / unregister-user) and Value the tag, as parsed from
+// Message (it is empty if it can't be parsed)
+type EntryResult struct {
+	Op             Operation
+	Subject, Value string
+	Message        string
+	Kind           ErrorKind
+}
+
+// Failed returns true if the entry was not applied. Registering an existing entry or unregistering a non
+// existing one are not considered failures
+func (r EntryResult) Failed() bool {
+	switch r.Kind {
+	case KindNone, KindAlreadyExists, KindNotExist:
+		return false
+	}
+	return true
+}
+
+// PartialError is returned by Validate() for non "success" responses that contain per-entry results
+type PartialError struct {
+	Status  string
+	Entries []EntryResult
+}
+
+func (e *PartialError) Error() string {
+	failed := 0
+	for _, r := range e.Entries {
+		if r.Failed() {
+			failed++
+		}
+	}
+	return fmt.Sprintf("returned a non-sucess response (status: '%v', %v entries, %v failed)", e.Status, len(e.Entries), failed)
+}
+
+var tagMsg = regexp.MustCompile(`^tag ['"]?(.+?)['"]?(?::| already exist| does not exist| not exist)`)
+
+func classify(msg string) (k ErrorKind) {
+	lmsg := strings.ToLower(msg)
+	switch {
+	case msg == "":
+		k = KindNone
+	case strings.Contains(lmsg, "already exist"):
+		k = KindAlreadyExists
+	case strings.Contains(lmsg, "not exist"), strings.Contains(lmsg, "not found"):
+		k = KindNotExist
+	case strings.Contains(lmsg, "limit"), strings.Contains(lmsg, "maximum"), strings.Contains(lmsg, "exceed"):
+		k = KindLimit
+	case strings.Contains(lmsg, "invalid"):
+		k = KindInvalid
+	default:
+		k = KindUnknown
+	}
+	return
+}
+
+func appendResults(out []EntryResult, op Operation, entries []x.UIDResponseEntry) []EntryResult {
+	for _, e := range entries {
+		r := EntryResult{Op: op, Subject: e.IP, Message: e.Msg, Kind: classify(e.Msg)}
+		if r.Subject == "" {
+			r.Subject = e.User
+		}
+		if m := tagMsg.FindStringSubmatch(e.Msg); m != nil {
+			r.Value = m[1]
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// Results returns the list of per-entry results contained in a PAN-OS User-ID response
+func Results(apiResp *x.APIResponse) (out []EntryResult) {
+	if apiResp == nil {
+		return
+	}
+	uidResp := []*x.UIDResponse{}
+	if apiResp.Result != nil && apiResp.Result.UidResponse != nil {
+		uidResp = append(uidResp, apiResp.Result.UidResponse)
+	}
+	if apiResp.Msg != nil {
+		for _, l := range apiResp.Msg.Line {
+			if l.UidResponse != nil {
+				uidResp = append(uidResp, l.UidResponse)
+			}
+		}
+	}
+	for _, u := range uidResp {
+		if p := u.Payload.Unregister; p != nil {
+			out = appendResults(out, Unregister, p.Entry)
+		}
+		if p := u.Payload.UnregisterUser; p != nil {
+			out = appendResults(out, Ungroup, p.Entry)
+		}
+		if p := u.Payload.RegisterUser; p != nil {
+			out = appendResults(out, Group, p.Entry)
+		}
+		if p := u.Payload.Register; p != nil {
+			out = appendResults(out, Register, p.Entry)
+		}
+	}
+	return
+}
+
+// resultKey identifies a (subject, value) pair of a payload section
+type resultKey struct {
+	op             Operation
+	subject, value string
+}
+
+// sent returns the (subject, value) pairs of the DAG / DUG sections in the order they are written in the
+// payload
+func (mp UIDBuilder) sent() (pairs map[Operation][]resultKey) {
+	pairs = map[Operation][]resultKey{}
+	p, err := mp.Lenient().Payload(nil)
+	if err != nil {
+		return
+	}
+	dag := func(op Operation, s *x.UIDMsgPldDAGRegUnreg) {
+		if s != nil {
+			for _, e := range s.Entry {
+				for _, m := range e.Tag.Member {
+					pairs[op] = append(pairs[op], resultKey{op, e.IP, m.Member})
+				}
+			}
+		}
+	}
+	dug := func(op Operation, s *x.UIDMsgPldDUGRegUnreg) {
+		if s != nil {
+			for _, e := range s.Entry {
+				for _, m := range e.Tag.Member {
+					pairs[op] = append(pairs[op], resultKey{op, e.User, m.Member})
+				}
+			}
+		}
+	}
+	dag(Unregister, p.Unregister)
+	dug(Ungroup, p.UnregisterUser)
+	dug(Group, p.RegisterUser)
+	dag(Register, p.Register)
+	return
+}
+
+// named returns the longest value of subject in pairs that msg refers to as "tag <value>"
+func named(msg, subject string, pairs []resultKey) (value string) {
+	for _, pr := range pairs {
+		if pr.subject != subject || len(pr.value) <= len(value) {
+			continue
+		}
+		for _, quote := range []string{"", "'", `"`} {
+			ref := "tag " + quote + pr.value + quote
+			for off := 0; off < len(msg); {
+				idx := strings.Index(msg[off:], ref)
+				if idx < 0 {
+					break
+				}
+				if end := off + idx + len(ref); end == len(msg) || strings.ContainsRune(" \t:,;.)", rune(msg[end])) {
+					value = pr.value
+					break
+				}
+				off += idx + 1
+			}
+		}
+	}
+	return
+}
+
+/*
+Failed returns a new builder (with the same mode) containing only the entries of this
+builder that are reported as failed in results (see EntryResult.Failed()). Its common
+use case is to retry them.
+
+PAN-OS results identify entries by IP or user only, so the value (tag or group) of a
+failed result is recovered from, in order: its Value field, the "tag <value>" mention
+of one of the subject values in its Message and its position in the section (only when
+the section results list every pair sent, in the same order). If none of them works,
+all values of the subject not reported as applied by other results are considered
+failed
+*/
+func (mp UIDBuilder) Failed(results []EntryResult) (mpB UIDBuilder) {
+	sent := mp.sent()
+	applied := map[resultKey]bool{}
+	section := map[Operation][]EntryResult{}
+	for _, r := range results {
+		if !r.Failed() && r.Value != "" {
+			applied[resultKey{r.Op, r.Subject, r.Value}] = true
+		}
+		section[r.Op] = append(section[r.Op], r)
+	}
+	failed := make(map[resultKey]bool, len(results))
+	for op, rs := range section {
+		pairs := sent[op]
+		positional := len(rs) == len(pairs)
+		for idx := 0; positional && idx < len(rs); idx++ {
+			positional = rs[idx].Subject == pairs[idx].subject
+		}
+		for idx, r := range rs {
+			if !r.Failed() {
+				continue
+			}
+			value := r.Value
+			if value == "" {
+				value = named(r.Message, r.Subject, pairs)
+			}
+			if value == "" && positional {
+				value = pairs[idx].value
+			}
+			if value != "" {
+				failed[resultKey{op, r.Subject, value}] = true
+				continue
+			}
+			for _, pr := range pairs {
+				if pr.subject == r.Subject && !applied[pr] {
+					failed[pr] = true
+				}
+			}
+		}
+	}
+	mpB = mp
+	mpB.entries, mpB.entriesTip = make([]payload, 0, len(failed)), nil
+	mpB.invalid, mpB.invalidTip = nil, nil
+	for _, e := range mp.entries {
+		en := e.entry()
+		if failed[resultKey{en.Op, en.Subject, en.Value}] {
+			mpB.entries = append(mpB.entries, e)
+		}
+	}
+	return
+}
@@ -0,0 +1,114 @@
+package uid_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	x "github.com/xhoms/panoslib/collection"
+	"github.com/xhoms/panoslib/uid"
+)
+
+func TestPartialError(t *testing.T) {
+	var respBody client = `
+<response status="error">
+	<msg>
+		<line>
+			<uid-response>
+				<version>2.0</version>
+				<payload>
+					<unregister>
+						<entry ip="2.2.2.2" message="tag bar does not exist, ignore"/>
+					</unregister>
+					<register>
+						<entry ip="1.1.1.1" message="tag foo already exists, ignore"/>
+						<entry ip="1.1.2.2" message="tag bar: maximum number of tags per IP reached"/>
+						<entry ip="1.1.3.3" message="unexpected failure"/>
+					</register>
+				</payload>
+			</uid-response>
+		</line>
+	</msg>
+</response>
+`
+	mp := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		RegisterIP("1.1.2.2", "foo", nil).
+		RegisterIP("1.1.2.2", "bar", nil).
+		RegisterIP("1.1.3.3", "foo", nil).
+		RegisterIP("1.1.3.3", "bar", nil).
+		UnregisterIP("2.2.2.2", "bar")
+	_, err := uid.Validate(mp.Push("vm.test.local", "apikey", respBody, nil))
+	var perr *uid.PartialError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a PartialError, got %v", err)
+	}
+	kinds := []uid.ErrorKind{uid.KindNotExist, uid.KindAlreadyExists, uid.KindLimit, uid.KindUnknown}
+	if len(perr.Entries) != len(kinds) {
+		t.Fatalf("expected %v entries, got %v", len(kinds), len(perr.Entries))
+	}
+	for idx, k := range kinds {
+		if perr.Entries[idx].Kind != k {
+			t.Errorf("entry %v: expected kind %v, got %v", idx, k, perr.Entries[idx].Kind)
+		}
+	}
+	if perr.Entries[1].Op != uid.Register || perr.Entries[1].Subject != "1.1.1.1" || perr.Entries[1].Value != "foo" {
+		t.Error("unexpected entry details")
+	}
+	var p *x.UIDMsgPayload
+	if p, err = mp.Failed(perr.Entries).Payload(nil); err == nil {
+		// only bar is retried for 1.1.2.2 while the 1.1.3.3 tag can't be recovered so both of its tags are
+		if p.Unregister == nil && p.Register != nil && len(p.Register.Entry) == 2 &&
+			len(p.Register.Entry[0].Tag.Member) == 1 && p.Register.Entry[0].Tag.Member[0].Member == "bar" &&
+			len(p.Register.Entry[1].Tag.Member) == 2 {
+			return
+		}
+		err = errors.New("recovery error")
+	}
+	t.Error(err)
+}
+
+// partialBody returns a partial error response with the provided register result entries
+func partialBody(entries string) client {
+	return client(`<response status="error"><msg><line><uid-response><version>2.0</version><payload><register>` +
+		entries + `</register></payload></uid-response></line></msg></response>`)
+}
+
+func TestFailedSingleTag(t *testing.T) {
+	mp := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		RegisterIP("1.1.1.1", "bar", nil).
+		RegisterIP("1.1.1.1", "barbaz", nil).
+		RegisterIP("2.2.2.2", "foo", nil).
+		RegisterIP("2.2.2.2", "bar", nil)
+	cases := []struct {
+		entries  string
+		expected map[string]string
+	}{
+		// the tag is mentioned in the message
+		{`<entry ip="1.1.1.1" message="failed to register tag barbaz, limit reached"/>`,
+			map[string]string{"1.1.1.1": "barbaz"}},
+		// the tag can't be recovered from the message but the section lists all pairs sent
+		{`<entry ip="1.1.1.1" message=""/><entry ip="1.1.1.1" message="internal error"/><entry ip="1.1.1.1" message=""/>` +
+			`<entry ip="2.2.2.2" message=""/><entry ip="2.2.2.2" message=""/>`,
+			map[string]string{"1.1.1.1": "barbaz"}},
+		// unrecoverable tag, the ones reported as applied are not retried
+		{`<entry ip="2.2.2.2" message="tag bar already exists, ignore"/><entry ip="2.2.2.2" message="internal error"/>`,
+			map[string]string{"2.2.2.2": "foo"}},
+	}
+	for idx, c := range cases {
+		_, err := uid.Validate(mp.Push("vm.test.local", "apikey", partialBody(c.entries), nil))
+		var perr *uid.PartialError
+		if !errors.As(err, &perr) {
+			t.Fatalf("case %v: expected a PartialError, got %v", idx, err)
+		}
+		retried := map[string]string{}
+		mp.Failed(perr.Entries).Each(func(e uid.Entry) bool {
+			retried[e.Subject] += e.Value
+			return true
+		})
+		if fmt.Sprint(retried) != fmt.Sprint(c.expected) {
+			t.Errorf("case %v: expected %v to be retried, got %v", idx, c.expected, retried)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package uid
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy describes how PushContext() retries attempts that failed because of transient conditions.
+// Use an initialized version as provided by NewRetryPolicy() and tune its fields as needed
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts (including the first one). Values lower than 1 mean 1
+	MaxAttempts int
+	// InitialBackoff is the wait time before the second attempt
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait time between attempts
+	MaxBackoff time.Duration
+	// Multiplier is applied to the wait time after each attempt. Values lower than 1 mean 1
+	Multiplier float64
+	// Jitter randomizes the wait time in the range +/- Jitter (0 to 1) fraction
+	Jitter float64
+	// AttemptTimeout bounds the duration of each attempt (zero means no timeout)
+	AttemptTimeout time.Duration
+	// RetryStatus is the list of HTTP status codes considered transient
+	RetryStatus []int
+	// Retryable decides whether an error returned by the Client is transient. IsTransient() is used if nil
+	Retryable func(err error) bool
+}
+
+// NewRetryPolicy returns a ready-to-consume RetryPolicy with 3 attempts, exponential backoff starting at
+// 500ms (factor 2, capped to 10s, 20% jitter), 30 seconds per attempt and retries on 429 and 5xx gateway
+// and availability errors
+func NewRetryPolicy() (p *RetryPolicy) {
+	p = &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		AttemptTimeout: 30 * time.Second,
+		RetryStatus: []int{
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+	return
+}
+
+// IsTransient returns true for network errors that are worth retrying: timeouts, connection resets,
+// refused connections, broken pipes and connections closed before a response was received
+func IsTransient(err error) bool {
+	var nerr net.Error
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE):
+		return true
+	case errors.As(err, &nerr):
+		return nerr.Timeout()
+	}
+	return false
+}
+
+func (p *RetryPolicy) attempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) retry(resp *http.Response, err error) bool {
+	if err != nil {
+		if p.Retryable != nil {
+			return p.Retryable(err)
+		}
+		return IsTransient(err)
+	}
+	for _, code := range p.RetryStatus {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait time after the attempt number provided (starting at 1)
+func (p *RetryPolicy) backoff(attempt int) (d time.Duration) {
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+	wait := float64(p.InitialBackoff) * math.Pow(mult, float64(attempt-1))
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		wait = wait * (1 + p.Jitter*(2*rand.Float64()-1))
+	}
+	if wait > 0 {
+		d = time.Duration(wait)
+	}
+	return
+}
+
+// attempt performs a single request. When a per-attempt timeout is configured the response body is read
+// in full before the attempt context is released
+func (p *RetryPolicy) attempt(ctx context.Context, c Client, newReq func(context.Context) (*http.Request, error)) (resp *http.Response, err error) {
+	actx := ctx
+	if p != nil && p.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		actx, cancel = context.WithTimeout(ctx, p.AttemptTimeout)
+		defer cancel()
+	}
+	var req *http.Request
+	if req, err = newReq(actx); err != nil {
+		return
+	}
+	if resp, err = c.Do(req); err == nil && actx != ctx {
+		body, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			resp, err = nil, readErr
+		} else {
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+	}
+	return
+}
+
+// do runs attempts following the policy until one of them succeeds, a non-transient error is found, the
+// attempts are exhausted or the context is done. A nil policy performs a single attempt
+func (p *RetryPolicy) do(ctx context.Context, c Client, newReq func(context.Context) (*http.Request, error)) (resp *http.Response, err error) {
+	attempts := p.attempts()
+	for attempt := 1; ; attempt++ {
+		resp, err = p.attempt(ctx, c, newReq)
+		if attempt >= attempts || ctx.Err() != nil || !p.retry(resp, err) {
+			return
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			resp, err = nil, ctx.Err()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+/*
+PushContext is a final action. It merges all accumulated data into a ready-to use
+PAN-OS XML User-ID API message and sends it to the device leveraging a provided
+http.Client. The message is marshaled once and re-sent following the provided
+retry policy (a nil policy means a single attempt) as long as the context is not
+done. The API key is sent in the form body, use PushTarget() to send it in the
+X-PAN-KEY header instead.
+
+If a variable implementing the Monitor interface is provided then a log entry
+will be issued to it for every entry in the payload. Order of log entries will
+be unregister > unregister-user > logout > login > groups > register-user > register
+*/
+func (mp UIDBuilder) PushContext(
+	ctx context.Context,
+	hostport, apikey string,
+	c Client,
+	m Monitor,
+	policy *RetryPolicy) (resp *http.Response, err error) {
+	return mp.PushTarget(ctx, Target{HostPort: hostport, APIKey: apikey}, c, m, policy)
+}
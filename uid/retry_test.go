@@ -0,0 +1,133 @@
+package uid_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/xhoms/panoslib/uid"
+)
+
+const successBody = `<response status="success"><result><uid-response><version>2.0</version></uid-response></result></response>`
+
+// flakyClient fails the first n requests with either the provided status code or error
+type flakyClient struct {
+	n        int
+	status   int
+	err      error
+	attempts int
+	bodies   []string
+}
+
+func (c *flakyClient) Do(req *http.Request) (resp *http.Response, err error) {
+	c.attempts++
+	body, _ := ioutil.ReadAll(req.Body)
+	c.bodies = append(c.bodies, string(body))
+	if c.attempts <= c.n {
+		if c.err != nil {
+			return nil, c.err
+		}
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			StatusCode: c.status,
+		}, nil
+	}
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(successBody))),
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+func fastPolicy() (p *uid.RetryPolicy) {
+	p = uid.NewRetryPolicy()
+	p.InitialBackoff = time.Millisecond
+	p.MaxBackoff = 5 * time.Millisecond
+	return
+}
+
+func TestPushContextRetryStatus(t *testing.T) {
+	c := &flakyClient{n: 2, status: http.StatusServiceUnavailable}
+	var err error
+	var resp *http.Response
+	if resp, err = uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		PushContext(context.Background(), "vm.test.local", "apikey", c, nil, fastPolicy()); err == nil {
+		if _, err = uid.Validate(resp, err); err == nil {
+			if c.attempts == 3 && c.bodies[0] == c.bodies[2] {
+				return
+			}
+			err = fmt.Errorf("unexpected number of attempts (%v)", c.attempts)
+		}
+	}
+	t.Error(err)
+}
+
+func TestPushContextRetryErr(t *testing.T) {
+	c := &flakyClient{n: 1, err: fmt.Errorf("read: %w", syscall.ECONNRESET)}
+	var err error
+	var resp *http.Response
+	if resp, err = uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		PushContext(context.Background(), "vm.test.local", "apikey", c, nil, fastPolicy()); err == nil {
+		if _, err = uid.Validate(resp, err); err == nil && c.attempts == 2 {
+			return
+		}
+	}
+	t.Error(err)
+}
+
+func TestPushContextExhausted(t *testing.T) {
+	c := &flakyClient{n: 5, status: http.StatusBadGateway}
+	resp, err := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		PushContext(context.Background(), "vm.test.local", "apikey", c, nil, fastPolicy())
+	if _, err = uid.Validate(resp, err); err == nil || c.attempts != 3 {
+		t.Errorf("expected failure after 3 attempts (got %v)", c.attempts)
+	}
+}
+
+func TestPushContextNotRetryable(t *testing.T) {
+	c := &flakyClient{n: 5, err: errors.New("permanent")}
+	if _, err := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		PushContext(context.Background(), "vm.test.local", "apikey", c, nil, fastPolicy()); err == nil || c.attempts != 1 {
+		t.Errorf("expected a single attempt (got %v)", c.attempts)
+	}
+}
+
+// blockingClient honors the request context and never replies
+type blockingClient struct{}
+
+func (blockingClient) Do(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestPushContextAttemptTimeout(t *testing.T) {
+	p := fastPolicy()
+	p.AttemptTimeout = 10 * time.Millisecond
+	start := time.Now()
+	if _, err := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		PushContext(context.Background(), "vm.test.local", "apikey", blockingClient{}, nil, p); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error (got %v)", err)
+	} else if time.Since(start) > time.Second {
+		t.Error("attempts took too long")
+	}
+}
+
+func TestPushContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		PushContext(ctx, "vm.test.local", "apikey", blockingClient{}, nil, fastPolicy()); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled error (got %v)", err)
+	}
+}
@@ -0,0 +1,223 @@
+package uid
+
+import (
+	"sort"
+	"strconv"
+
+	x "github.com/xhoms/panoslib/collection"
+)
+
+// sectionItem is a single (deduplicated) entry of a payload section
+type sectionItem struct {
+	subject, value string
+	tout           *uint
+	persistent     bool
+}
+
+// sections holds the payload sections as sorted lists. It is the single source of the payload built by
+// Payload() and the message written by Encode()
+type sections struct {
+	unreg, ungroup, logout, login, group, reg []sectionItem
+	members                                   []GroupMembers
+}
+
+// sortItems sorts the section by subject and value keeping only the last item added for each pair
+func sortItems(items []sectionItem) []sectionItem {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].subject != items[j].subject {
+			return items[i].subject < items[j].subject
+		}
+		return items[i].value < items[j].value
+	})
+	out := items[:0]
+	for idx, it := range items {
+		if idx+1 < len(items) && items[idx+1].subject == it.subject && items[idx+1].value == it.value {
+			continue
+		}
+		out = append(out, it)
+	}
+	return out
+}
+
+// runs invokes f for every entry of a DAG / DUG section, that is, the consecutive items with the same
+// subject and persistence
+func runs(items []sectionItem, f func(run []sectionItem)) {
+	for start := 0; start < len(items); {
+		end := start
+		for end < len(items) && items[end].subject == items[start].subject &&
+			items[end].persistent == items[start].persistent {
+			end++
+		}
+		f(items[start:end])
+		start = end
+	}
+}
+
+// sections returns the sorted sections of the payload (see Payload())
+func (mp UIDBuilder) sections() (s *sections, err error) {
+	if err = mp.Err(); err != nil {
+		return
+	}
+	entries := mp.entries
+	if mp.collapse {
+		entries = collapse(entries)
+	}
+	s = &sections{}
+	members := []GroupMembers{}
+	for _, e := range entries {
+		switch {
+		case e.unregister_ip != nil && e.unregister_tag != nil:
+			s.unreg = append(s.unreg, sectionItem{subject: *e.unregister_ip, value: *e.unregister_tag})
+		case e.ungroup_user != nil && e.ungroup_group != nil:
+			s.ungroup = append(s.ungroup, sectionItem{subject: *e.ungroup_user, value: *e.ungroup_group})
+		case e.logout_ip != nil && e.logout_user != nil:
+			s.logout = append(s.logout, sectionItem{subject: *e.logout_user, value: *e.logout_ip})
+		case e.login != nil:
+			s.login = append(s.login, sectionItem{subject: e.login.User, value: e.login.IP, tout: e.login.Tout})
+		case e.members != nil:
+			members = append(members, *e.members)
+		case e.group != nil:
+			s.group = append(s.group, sectionItem{subject: e.group.User, value: e.group.Group, tout: e.group.Tout})
+		case e.register != nil:
+			s.reg = append(s.reg, sectionItem{
+				subject:    e.register.IP,
+				value:      e.register.Tag,
+				tout:       e.register.Tout,
+				persistent: e.register.Persistent,
+			})
+		}
+	}
+	s.unreg, s.ungroup = sortItems(s.unreg), sortItems(s.ungroup)
+	s.logout, s.login = sortItems(s.logout), sortItems(s.login)
+	s.group, s.reg = sortItems(s.group), sortItems(s.reg)
+	// persistent and non-persistent tags of an IP go into different entries (non-persistent first). The
+	// sort is stable so tags remain sorted within each entry
+	sort.SliceStable(s.reg, func(i, j int) bool {
+		if s.reg[i].subject != s.reg[j].subject {
+			return s.reg[i].subject < s.reg[j].subject
+		}
+		return !s.reg[i].persistent && s.reg[j].persistent
+	})
+	sort.SliceStable(members, func(i, j int) bool { return members[i].Group < members[j].Group })
+	for idx, gm := range members {
+		if idx+1 < len(members) && members[idx+1].Group == gm.Group {
+			continue
+		}
+		s.members = append(s.members, gm)
+	}
+	return
+}
+
+// log issues the log entries in payload order (see Payload())
+func (s *sections) log(mp UIDBuilder, m Monitor) {
+	if m == nil {
+		return
+	}
+	for _, it := range s.unreg {
+		mp.log(m, Unregister, it.subject, it.value, nil)
+	}
+	for _, it := range s.ungroup {
+		mp.log(m, Ungroup, it.subject, it.value, nil)
+	}
+	for _, it := range s.logout {
+		mp.log(m, Logout, it.subject, it.value, nil)
+	}
+	for _, it := range s.login {
+		mp.log(m, Login, it.subject, it.value, it.tout)
+	}
+	for _, gm := range s.members {
+		mp.logMembers(m, gm)
+	}
+	for _, it := range s.group {
+		mp.log(m, Group, it.subject, it.value, it.tout)
+	}
+	for _, it := range s.reg {
+		if it.persistent {
+			mp.logPersistent(m, it.subject, it.value, it.tout)
+		} else {
+			mp.log(m, Register, it.subject, it.value, it.tout)
+		}
+	}
+}
+
+func toutstr(tout *uint) (s *string) {
+	if tout != nil {
+		str := strconv.FormatUint(uint64(*tout), 10)
+		s = &str
+	}
+	return
+}
+
+func tagMembers(run []sectionItem) (members []x.UIDMsgPldDxGEnrtryTagMember) {
+	members = make([]x.UIDMsgPldDxGEnrtryTagMember, len(run))
+	for idx, it := range run {
+		members[idx] = x.UIDMsgPldDxGEnrtryTagMember{Member: it.value, Timeout: toutstr(it.tout)}
+	}
+	return
+}
+
+func dagSection(items []sectionItem) (dag *x.UIDMsgPldDAGRegUnreg) {
+	dag = &x.UIDMsgPldDAGRegUnreg{}
+	runs(items, func(run []sectionItem) {
+		entry := x.UIDMsgPldDAGEntry{IP: run[0].subject, Tag: x.UIDMsgPldDxGEntryTag{Member: tagMembers(run)}}
+		if run[0].persistent {
+			entry.Persistent = "1"
+		}
+		dag.Entry = append(dag.Entry, entry)
+	})
+	return
+}
+
+func dugSection(items []sectionItem) (dug *x.UIDMsgPldDUGRegUnreg) {
+	dug = &x.UIDMsgPldDUGRegUnreg{}
+	runs(items, func(run []sectionItem) {
+		entry := x.UIDMsgPldDUGEntry{User: run[0].subject, Tag: x.UIDMsgPldDxGEntryTag{Member: tagMembers(run)}}
+		dug.Entry = append(dug.Entry, entry)
+	})
+	return
+}
+
+func logSection(items []sectionItem) (log *x.UIDMsgPldLogInOut) {
+	log = &x.UIDMsgPldLogInOut{Entry: make([]x.UIDMsgPldLogEntry, len(items))}
+	for idx, it := range items {
+		log.Entry[idx] = x.UIDMsgPldLogEntry{Name: it.subject, IP: it.value, Timeout: toutstr(it.tout)}
+	}
+	return
+}
+
+// payload returns the sections as a PAN-OS XML User-ID API payload
+func (s *sections) payload() (p *x.UIDMsgPayload) {
+	p = &x.UIDMsgPayload{}
+	if len(s.unreg) > 0 {
+		p.Unregister = dagSection(s.unreg)
+	}
+	if len(s.ungroup) > 0 {
+		p.UnregisterUser = dugSection(s.ungroup)
+	}
+	if len(s.logout) > 0 {
+		p.Logout = logSection(s.logout)
+	}
+	if len(s.login) > 0 {
+		p.Login = logSection(s.login)
+	}
+	if len(s.members) > 0 {
+		p.Groups = &x.UIDMsgPldGroups{Entry: make([]x.UIDMsgPldGroupEntry, len(s.members))}
+		for idx, gm := range s.members {
+			entry := x.UIDMsgPldGroupEntry{
+				Name:    gm.Group,
+				Members: x.UIDMsgPldGroupMembers{Entry: make([]x.UIDMsgPldGroupMember, len(gm.Users))},
+			}
+			for uidx, user := range gm.Users {
+				entry.Members.Entry[uidx] = x.UIDMsgPldGroupMember{Name: user}
+			}
+			p.Groups.Entry[idx] = entry
+		}
+	}
+	if len(s.group) > 0 {
+		p.RegisterUser = dugSection(s.group)
+	}
+	if len(s.reg) > 0 {
+		p.Register = dagSection(s.reg)
+	}
+	return
+}
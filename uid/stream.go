@@ -0,0 +1,191 @@
+package uid
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// xmlWriter writes XML tokens keeping the first error found
+type xmlWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (xw *xmlWriter) raw(s string) {
+	if xw.err == nil {
+		_, xw.err = xw.w.WriteString(s)
+	}
+}
+
+func (xw *xmlWriter) text(s string) {
+	if xw.err == nil {
+		xw.err = xml.EscapeText(xw.w, []byte(s))
+	}
+}
+
+func (xw *xmlWriter) attr(name, value string) {
+	xw.raw(" ")
+	xw.raw(name)
+	xw.raw(`="`)
+	xw.text(value)
+	xw.raw(`"`)
+}
+
+func (xw *xmlWriter) tout(tout *uint) {
+	if tout != nil {
+		xw.attr("timeout", strconv.FormatUint(uint64(*tout), 10))
+	}
+}
+
+// tags writes a DAG / DUG section (one entry per run, see runs())
+func (xw *xmlWriter) tags(section, subjectAttr string, items []sectionItem) {
+	if len(items) == 0 {
+		return
+	}
+	xw.raw("<" + section + ">")
+	runs(items, func(run []sectionItem) {
+		xw.raw("<entry")
+		xw.attr(subjectAttr, run[0].subject)
+		if run[0].persistent {
+			xw.attr("persistent", "1")
+		}
+		xw.raw("><tag>")
+		for _, it := range run {
+			xw.raw("<member")
+			xw.tout(it.tout)
+			xw.raw(">")
+			xw.text(it.value)
+			xw.raw("</member>")
+		}
+		xw.raw("</tag></entry>")
+	})
+	xw.raw("</" + section + ">")
+}
+
+func (xw *xmlWriter) logs(section string, items []sectionItem) {
+	if len(items) == 0 {
+		return
+	}
+	xw.raw("<" + section + ">")
+	for _, it := range items {
+		xw.raw("<entry")
+		xw.attr("name", it.subject)
+		xw.attr("ip", it.value)
+		xw.tout(it.tout)
+		xw.raw("></entry>")
+	}
+	xw.raw("</" + section + ">")
+}
+
+// write encodes the uid-message. The output is the same xml.Marshal() produces for UIDMessage()
+func (s *sections) write(w io.Writer) (err error) {
+	xw := &xmlWriter{w: bufio.NewWriter(w)}
+	xw.raw("<uid-message><type>update</type><payload>")
+	xw.tags("register", "ip", s.reg)
+	xw.tags("unregister", "ip", s.unreg)
+	xw.tags("register-user", "user", s.group)
+	xw.tags("unregister-user", "user", s.ungroup)
+	xw.logs("login", s.login)
+	xw.logs("logout", s.logout)
+	if len(s.members) > 0 {
+		xw.raw("<groups>")
+		for _, gm := range s.members {
+			xw.raw("<entry")
+			xw.attr("name", gm.Group)
+			xw.raw("><members>")
+			for _, user := range gm.Users {
+				xw.raw("<entry")
+				xw.attr("name", user)
+				xw.raw("></entry>")
+			}
+			xw.raw("</members></entry>")
+		}
+		xw.raw("</groups>")
+	}
+	xw.raw("</payload><version>2.0</version></uid-message>")
+	if err = xw.err; err == nil {
+		err = xw.w.Flush()
+	}
+	return
+}
+
+/*
+Encode is a final action. It writes the same PAN-OS XML User-ID API message than
+UIDMessage() (once marshaled) directly into w without building the intermediate
+payload tree, which reduces memory usage for large payloads.
+
+If a variable implementing the Monitor interface is provided then a log entry
+will be issued to it for every entry in the payload. Order of log entries will
+be unregister > unregister-user > logout > login > groups > register-user > register
+*/
+func (mp UIDBuilder) Encode(w io.Writer, m Monitor) (err error) {
+	var s *sections
+	if s, err = mp.sections(); err == nil {
+		s.log(mp, m)
+		err = s.write(w)
+	}
+	return
+}
+
+// queryWriter query escapes everything written to w
+type queryWriter struct {
+	w io.Writer
+}
+
+func (qw queryWriter) Write(p []byte) (n int, err error) {
+	if _, err = io.WriteString(qw.w, url.QueryEscape(string(p))); err == nil {
+		n = len(p)
+	}
+	return
+}
+
+/*
+PushStream is a final action. It behaves like PushTarget() but the message is
+encoded (see Encode()) while the request body is being sent, so neither the message
+nor the form body are held in memory. The request uses chunked transfer encoding.
+The message is encoded again for every attempt of the retry policy.
+
+If a variable implementing the Monitor interface is provided then a log entry
+will be issued to it for every entry in the payload (once, no matter the number of
+attempts). Order of log entries will be unregister > unregister-user > logout >
+login > groups > register-user > register
+*/
+func (mp UIDBuilder) PushStream(
+	ctx context.Context,
+	t Target,
+	c Client,
+	m Monitor,
+	policy *RetryPolicy) (resp *http.Response, err error) {
+	var s *sections
+	if s, err = mp.sections(); err != nil {
+		return
+	}
+	s.log(mp, m)
+	prefix := t.formValues().Encode() + "&cmd="
+	readers := []*io.PipeReader{}
+	// pipes not fully consumed by the client (i.e. failed attempts) are closed to release their writers
+	defer func() {
+		for _, pr := range readers {
+			pr.CloseWithError(io.ErrClosedPipe)
+		}
+	}()
+	resp, err = policy.do(ctx, c, func(ctx context.Context) (*http.Request, error) {
+		pr, pw := io.Pipe()
+		readers = append(readers, pr)
+		go func() {
+			_, werr := io.WriteString(pw, prefix)
+			if werr == nil {
+				werr = s.write(queryWriter{pw})
+			}
+			pw.CloseWithError(werr)
+		}()
+		return t.newRequest(ctx, pr)
+	})
+	err = Redact(err, t.APIKey)
+	return
+}
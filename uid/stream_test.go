@@ -0,0 +1,165 @@
+package uid_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/xhoms/panoslib/uid"
+)
+
+func streamBuilder() uid.UIDBuilder {
+	var tout uint = 60
+	return uid.NewUIDBuilder().
+		RegisterIP("2.2.2.2", "foo", &tout).
+		RegisterIPPersistent("1.1.1.1", "foo", nil).
+		RegisterIP("1.1.1.1", "bar", nil).
+		RegisterIP("1.1.1.1", "bar", &tout).
+		UnregisterIP("3.3.3.3", "foo").
+		LoginUser("o'brien&co@test.local", "1.1.1.1", &tout).
+		LoginUser("bar@test.local", "2.2.2.2", nil).
+		LogoutUser("baz@test.local", "3.3.3.3").
+		GroupUser("bar@test.local", "admin", nil).
+		UngroupUser("baz@test.local", "admin").
+		SetGroupMembers("users", []string{"foo@test.local"}).
+		SetGroupMembers("admin", []string{"bar@test.local", "foo@test.local"}).
+		SetGroupMembers("users", []string{"bar@test.local"})
+}
+
+func TestEncode(t *testing.T) {
+	mp := streamBuilder()
+	r1, r2 := &recorder{}, &recorder{}
+	u, err := mp.UIDMessage(r1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []byte
+	if expected, err = xml.Marshal(u); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err = mp.Encode(buf, r2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("encoded message differs:\n%s\n%s", expected, buf.Bytes())
+	}
+	if fmt.Sprint(*r1) != fmt.Sprint(*r2) {
+		t.Errorf("monitor log differs:\n%v\n%v", *r1, *r2)
+	}
+}
+
+func TestEncodeCollapse(t *testing.T) {
+	mp := streamBuilder().UnregisterIP("2.2.2.2", "foo").LogoutUser("bar@test.local", "2.2.2.2").Collapse()
+	u, err := mp.UIDMessage(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := xml.Marshal(u)
+	buf := &bytes.Buffer{}
+	if err = mp.Encode(buf, nil); err != nil || !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("encoded message differs (%v):\n%s\n%s", err, expected, buf.Bytes())
+	}
+}
+
+// streamClient records the cmd form value of every request and fails the first ones without reading the body
+type streamClient struct {
+	fail int
+	cmds []string
+}
+
+func (c *streamClient) Do(req *http.Request) (resp *http.Response, err error) {
+	if c.fail > 0 {
+		c.fail--
+		return response(http.StatusServiceUnavailable, ""), nil
+	}
+	if err = req.ParseForm(); err == nil {
+		c.cmds = append(c.cmds, req.PostForm.Get("cmd"))
+		resp = response(http.StatusOK, successBody)
+	}
+	return
+}
+
+func TestPushStream(t *testing.T) {
+	mp := streamBuilder()
+	u, _ := mp.UIDMessage(nil)
+	expected, _ := xml.Marshal(u)
+	c := &streamClient{fail: 1}
+	policy := uid.NewRetryPolicy()
+	policy.InitialBackoff = 0
+	r := &recorder{}
+	target := uid.Target{HostPort: "fw.test.local", APIKey: "apikey", Vsys: "vsys2"}
+	_, err := uid.Validate(mp.PushStream(context.Background(), target, c, r, policy))
+	if err == nil {
+		if len(c.cmds) == 1 && c.cmds[0] == string(expected) && len(*r) == 14 {
+			return
+		}
+		err = fmt.Errorf("unexpected requests %v (%v log entries)", c.cmds, len(*r))
+	}
+	t.Error(err)
+}
+
+// drainClient reads and discards the request body
+type drainClient struct{}
+
+func (drainClient) Do(req *http.Request) (resp *http.Response, err error) {
+	if _, err = io.Copy(ioutil.Discard, req.Body); err == nil {
+		resp = response(http.StatusOK, successBody)
+	}
+	return
+}
+
+func benchBuilder(n int) (mp uid.UIDBuilder) {
+	mp = uid.NewUIDBuilder()
+	for idx := 0; idx < n; idx++ {
+		ip := fmt.Sprintf("10.%v.%v.%v", idx>>16&0xff, idx>>8&0xff, idx&0xff)
+		mp = mp.RegisterIP(ip, "tag", nil).LoginUser(fmt.Sprintf("user%v@test.local", idx), ip, nil)
+	}
+	return
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	mp := benchBuilder(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		u, _ := mp.UIDMessage(nil)
+		cmd, _ := xml.Marshal(u)
+		_ = url.Values{"cmd": []string{string(cmd)}}.Encode()
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	mp := benchBuilder(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		_ = mp.Encode(ioutil.Discard, nil)
+	}
+}
+
+func BenchmarkPushTarget(b *testing.B) {
+	mp := benchBuilder(10000)
+	target := uid.Target{HostPort: "fw.test.local", APIKey: "apikey"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		_, _ = mp.PushTarget(context.Background(), target, drainClient{}, nil, nil)
+	}
+}
+
+func BenchmarkPushStream(b *testing.B) {
+	mp := benchBuilder(10000)
+	target := uid.Target{HostPort: "fw.test.local", APIKey: "apikey"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		_, _ = mp.PushStream(context.Background(), target, drainClient{}, nil, nil)
+	}
+}
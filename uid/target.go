@@ -0,0 +1,138 @@
+package uid
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	x "github.com/xhoms/panoslib/collection"
+)
+
+// Target identifies a PAN-OS device (host:port) and the API key to use with it. Optionally, the User-ID
+// message can be addressed to a specific virtual system (Vsys) and, when HostPort is a Panorama, to the
+// managed firewall with the provided serial number (Serial). When KeyHeader is set the API key is sent
+// in the X-PAN-KEY header instead of the form body by all the functions and methods that accept a Target
+type Target struct {
+	HostPort, APIKey string
+	Vsys, Serial     string
+	KeyHeader        bool
+}
+
+// values returns the form values common to all requests of type typ (API key and Panorama target)
+func (t Target) values(typ string) url.Values {
+	values := url.Values{
+		"type": []string{typ},
+	}
+	if !t.KeyHeader {
+		values["key"] = []string{t.APIKey}
+	}
+	if t.Serial != "" {
+		values["target"] = []string{t.Serial}
+	}
+	return values
+}
+
+// formValues returns the form values of a User-ID request but the cmd one
+func (t Target) formValues() url.Values {
+	values := t.values("user-id")
+	if t.Vsys != "" {
+		values["vsys"] = []string{t.Vsys}
+	}
+	return values
+}
+
+func (t Target) encodeForm(cmd []byte) string {
+	values := t.formValues()
+	values["cmd"] = []string{string(cmd)}
+	return values.Encode()
+}
+
+// newRequest returns the POST request for the provided form body, adding the X-PAN-KEY header if needed
+func (t Target) newRequest(ctx context.Context, body io.Reader) (req *http.Request, err error) {
+	if req, err = newRequest(ctx, t.HostPort, body); err == nil && t.KeyHeader {
+		req.Header.Set("X-PAN-KEY", t.APIKey)
+	}
+	return
+}
+
+// send posts the marshaled uid-message following the retry policy. The API key is redacted from the
+// error returned (if any)
+func (t Target) send(ctx context.Context, cmd []byte, c Client, policy *RetryPolicy) (resp *http.Response, err error) {
+	form := t.encodeForm(cmd)
+	resp, err = policy.do(ctx, c, func(ctx context.Context) (*http.Request, error) {
+		return t.newRequest(ctx, strings.NewReader(form))
+	})
+	err = Redact(err, t.APIKey)
+	return
+}
+
+/*
+PushTarget is a final action. It behaves like PushContext() but the destination
+is described by a Target, which allows addressing a specific virtual system or a
+firewall managed by Panorama.
+
+If a variable implementing the Monitor interface is provided then a log entry
+will be issued to it for every entry in the payload. Order of log entries will
+be unregister > unregister-user > logout > login > groups > register-user > register
+*/
+func (mp UIDBuilder) PushTarget(
+	ctx context.Context,
+	t Target,
+	c Client,
+	m Monitor,
+	policy *RetryPolicy) (resp *http.Response, err error) {
+	var u *x.UIDMessage
+	if u, err = mp.UIDMessage(m); err == nil {
+		var cmd []byte
+		if cmd, err = xml.Marshal(u); err == nil {
+			resp, err = t.send(ctx, cmd, c, policy)
+		}
+	}
+	return
+}
+
+/*
+PushVsys is a final action. It sends the same message to every virtual system in
+vsys of the device described by t (its Vsys field is ignored). Virtual systems are
+processed one at a time and the returned map contains the result for each one of
+them (duplicated names are pushed only once). An error is returned only if the
+message can't be built.
+
+If a variable implementing the Monitor interface is provided then a log entry
+will be issued to it for every entry in the payload (once, no matter the number of
+virtual systems). Order of log entries will be unregister > unregister-user >
+logout > login > groups > register-user > register
+*/
+func (mp UIDBuilder) PushVsys(
+	ctx context.Context,
+	t Target,
+	vsys []string,
+	c Client,
+	m Monitor,
+	policy *RetryPolicy) (res map[string]FleetResult, err error) {
+	f := Fleet{
+		Targets: make([]Target, 0, len(vsys)),
+		Workers: 1,
+		Client:  c,
+		Retry:   policy,
+	}
+	seen := make(map[string]bool, len(vsys))
+	for _, v := range vsys {
+		if !seen[v] {
+			seen[v] = true
+			t.Vsys = v
+			f.Targets = append(f.Targets, t)
+		}
+	}
+	var fres []FleetResult
+	if fres, err = mp.PushFleet(ctx, f, m); err == nil {
+		res = make(map[string]FleetResult, len(fres))
+		for _, r := range fres {
+			res[r.Target.Vsys] = r
+		}
+	}
+	return
+}
@@ -0,0 +1,71 @@
+package uid_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/xhoms/panoslib/uid"
+)
+
+// formClient records the form values of every request
+type formClient struct {
+	lock  sync.Mutex
+	forms []url.Values
+}
+
+func (c *formClient) Do(req *http.Request) (resp *http.Response, err error) {
+	if err = req.ParseForm(); err == nil {
+		c.lock.Lock()
+		c.forms = append(c.forms, req.PostForm)
+		c.lock.Unlock()
+		resp = &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(successBody))),
+			StatusCode: http.StatusOK,
+		}
+	}
+	return
+}
+
+func TestPushTarget(t *testing.T) {
+	c := &formClient{}
+	target := uid.Target{HostPort: "panorama.test.local", APIKey: "apikey", Vsys: "vsys2", Serial: "0123456789"}
+	resp, err := uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		PushTarget(context.Background(), target, c, nil, nil)
+	if _, err = uid.Validate(resp, err); err == nil {
+		if len(c.forms) == 1 &&
+			c.forms[0].Get("type") == "user-id" &&
+			c.forms[0].Get("vsys") == "vsys2" &&
+			c.forms[0].Get("target") == "0123456789" {
+			return
+		}
+		err = errors.New("vsys or target not encoded")
+	}
+	t.Error(err)
+}
+
+func TestPushVsys(t *testing.T) {
+	c := &formClient{}
+	target := uid.Target{HostPort: "fw.test.local", APIKey: "apikey"}
+	var err error
+	var res map[string]uid.FleetResult
+	if res, err = uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		PushVsys(context.Background(), target, []string{"vsys1", "vsys2", "vsys3", "vsys2"}, c, nil, nil); err == nil {
+		seen := map[string]bool{}
+		for _, f := range c.forms {
+			seen[f.Get("vsys")] = true
+		}
+		if len(res) == 3 && res["vsys2"].Err == nil && len(c.forms) == 3 && len(seen) == 3 && seen["vsys3"] {
+			return
+		}
+		err = errors.New("recovery error")
+	}
+	t.Error(err)
+}
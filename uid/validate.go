@@ -0,0 +1,160 @@
+package uid
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxTagLength is the maximum number of characters PAN-OS accepts in a tag (DAG or DUG) name
+	MaxTagLength = 127
+	// MaxTagTimeout is the maximum timeout (in seconds) PAN-OS accepts for ip-to-tag and user-to-group entries
+	MaxTagTimeout = 2592000
+	// MaxLoginTimeout is the maximum timeout (in minutes) PAN-OS accepts for user-to-ip entries
+	MaxLoginTimeout = 43200
+)
+
+// Validation errors wrapped by EntryError
+var (
+	ErrInvalidIP    = errors.New("invalid IP address")
+	ErrEmptyUser    = errors.New("empty user name")
+	ErrEmptyGroup   = errors.New("empty group name")
+	ErrEmptyTag     = errors.New("empty tag")
+	ErrTagTooLong   = fmt.Errorf("tag longer than %v characters", MaxTagLength)
+	ErrTagChars     = errors.New("tag contains invalid characters")
+	ErrTimeoutRange = errors.New("timeout out of range")
+)
+
+// EntryError describes an entry rejected by the UIDBuilder. Subject and Value follow the same convention
+// than the Monitor interface (ip and tag, user and ip or user and group)
+type EntryError struct {
+	Op             Operation
+	Subject, Value string
+	Err            error
+}
+
+func (e EntryError) Error() string {
+	return fmt.Sprintf("%v %q %q: %v", e.Op, e.Subject, e.Value, e.Err)
+}
+
+func (e EntryError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError lists every entry rejected by the UIDBuilder. It is returned by the final actions
+// unless the builder is in lenient mode (see Lenient())
+type ValidationError struct {
+	Entries []EntryError
+}
+
+func (v *ValidationError) Error() string {
+	msg := make([]string, len(v.Entries))
+	for idx, e := range v.Entries {
+		msg[idx] = e.Error()
+	}
+	return fmt.Sprintf("%v invalid entries (%v)", len(v.Entries), strings.Join(msg, "; "))
+}
+
+func checkIP(ip string) (err error) {
+	if net.ParseIP(ip) == nil {
+		err = ErrInvalidIP
+	}
+	return
+}
+
+func checkUser(user string) (err error) {
+	if strings.TrimSpace(user) == "" {
+		err = ErrEmptyUser
+	}
+	return
+}
+
+func checkGroup(group string) (err error) {
+	if strings.TrimSpace(group) == "" {
+		err = ErrEmptyGroup
+	}
+	return
+}
+
+func checkTag(tag string) (err error) {
+	switch {
+	case tag == "":
+		err = ErrEmptyTag
+	case utf8.RuneCountInString(tag) > MaxTagLength:
+		err = ErrTagTooLong
+	case !utf8.ValidString(tag), strings.IndexFunc(tag, func(r rune) bool {
+		return unicode.IsControl(r) || strings.ContainsRune(`<>&"'`, r)
+	}) >= 0:
+		err = ErrTagChars
+	}
+	return
+}
+
+func checkTout(tout *uint, max uint) (err error) {
+	if tout != nil && *tout > max {
+		err = ErrTimeoutRange
+	}
+	return
+}
+
+// check returns the first validation error found for op and its arguments
+func check(op Operation, subject, value string, tout *uint) (err error) {
+	switch op {
+	case Register, Unregister:
+		if err = checkIP(subject); err == nil {
+			if err = checkTag(value); err == nil {
+				err = checkTout(tout, MaxTagTimeout)
+			}
+		}
+	case Login, Logout:
+		if err = checkUser(subject); err == nil {
+			if err = checkIP(value); err == nil {
+				err = checkTout(tout, MaxLoginTimeout)
+			}
+		}
+	case Group, Ungroup:
+		if err = checkUser(subject); err == nil {
+			if err = checkTag(value); err == nil {
+				err = checkTout(tout, MaxTagTimeout)
+			}
+		}
+	}
+	return
+}
+
+// reject returns a copy of the builder with the provided entry in its rejected list
+func (mp UIDBuilder) reject(op Operation, subject, value string, err error) (mpB UIDBuilder) {
+	mpB = mp.append(nil, []EntryError{{Op: op, Subject: subject, Value: value, Err: err}})
+	return
+}
+
+// Lenient switches the builder into "lenient" mode. In this mode rejected entries are just dropped and
+// the final actions do not fail because of them (they are still available with Rejected())
+func (mp UIDBuilder) Lenient() (mpB UIDBuilder) {
+	mpB = mp
+	mpB.lenient = true
+	return
+}
+
+// Rejected returns the list of entries that failed validation so far
+func (mp UIDBuilder) Rejected() (out []EntryError) {
+	out = make([]EntryError, len(mp.invalid))
+	copy(out, mp.invalid)
+	return
+}
+
+// Err returns the error a final action would fail with (if any). Rejected entries produce a
+// *ValidationError unless the builder is in lenient mode
+func (mp UIDBuilder) Err() (err error) {
+	switch {
+	case mp.err != nil:
+		err = mp.err
+	case len(mp.invalid) > 0 && !mp.lenient:
+		err = &ValidationError{Entries: mp.Rejected()}
+	}
+	return
+}
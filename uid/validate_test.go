@@ -0,0 +1,71 @@
+package uid_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	x "github.com/xhoms/panoslib/collection"
+	"github.com/xhoms/panoslib/uid"
+)
+
+func invalidBuilder() uid.UIDBuilder {
+	var tout uint = 43201
+	return uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		RegisterIP("1.1.1.300", "foo", nil).
+		RegisterIP("2001:db8::1", strings.Repeat("a", uid.MaxTagLength+1), nil).
+		UnregisterIP("1.1.1.1", "").
+		LoginUser("", "1.1.1.1", nil).
+		LoginUser("foo@test.local", "1.1.1.1", &tout).
+		LogoutUser("foo@test.local", "1.1.1.1").
+		GroupUser("foo@test.local", "bad<tag>", nil).
+		UngroupUser(" ", "admin")
+}
+
+func TestValidation(t *testing.T) {
+	_, err := invalidBuilder().Payload(nil)
+	var verr *uid.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	expected := []error{
+		uid.ErrInvalidIP,
+		uid.ErrTagTooLong,
+		uid.ErrEmptyTag,
+		uid.ErrEmptyUser,
+		uid.ErrTimeoutRange,
+		uid.ErrTagChars,
+		uid.ErrEmptyUser,
+	}
+	if len(verr.Entries) != len(expected) {
+		t.Fatalf("expected %v rejected entries, got %v", len(expected), len(verr.Entries))
+	}
+	for idx, e := range expected {
+		if !errors.Is(verr.Entries[idx], e) {
+			t.Errorf("entry %v: expected %v, got %v", idx, e, verr.Entries[idx])
+		}
+	}
+	if verr.Entries[0].Op != uid.Register || verr.Entries[0].Subject != "1.1.1.300" {
+		t.Error("unexpected rejected entry details")
+	}
+}
+
+func TestValidationLenient(t *testing.T) {
+	mp := invalidBuilder().Lenient()
+	var err error
+	var p *x.UIDMsgPayload
+	if p, err = mp.Payload(nil); err == nil {
+		switch {
+		case p.Register == nil, len(p.Register.Entry) != 1,
+			p.Unregister != nil, p.Login != nil,
+			p.Logout == nil, p.RegisterUser != nil, p.UnregisterUser != nil:
+			err = errors.New("recovery error")
+		case len(mp.Rejected()) != 7:
+			err = errors.New("rejected entries not reported")
+		default:
+			return
+		}
+	}
+	t.Error(err)
+}
@@ -23,9 +23,18 @@ import (
 var MSIZE = ""
 var MTOUT = ""
 
+// how the expiration of an item was provided
+const (
+	timed      = iota // explicit timeout
+	defaultTTL        // no timeout (device default)
+	neverTTL          // zero timeout (never expires)
+)
+
 type item struct {
 	subject, key string
 	Valid        int64
+	Persistent   bool `json:",omitempty"`
+	kind         int
 }
 
 type index map[string]map[string]*item
@@ -121,13 +130,15 @@ func (d *db) gb(t time.Time) {
 	d.items, d.index = d.items[idx:], imindex
 }
 
-func (d *db) append(subject, key string, valid int64) {
+func (d *db) append(subject, key string, valid int64, persistent bool, kind int) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	if im := d.index.get(subject, key); im != nil {
 		im.Valid = valid
+		im.Persistent = persistent
+		im.kind = kind
 	} else {
-		im := item{subject: subject, key: key, Valid: valid}
+		im := item{subject: subject, key: key, Valid: valid, Persistent: persistent, kind: kind}
 		d.index.add(&im)
 		d.items = append(d.items, &im)
 	}
@@ -152,6 +163,21 @@ func (d *db) remove(subject, key string) {
 	}
 }
 
+// keep removes all items but the ones matching f
+func (d *db) keep(f func(im *item) bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	items := make([]*item, 0, len(d.items))
+	var imindex index = make(map[string]map[string]*item)
+	for _, im := range d.items {
+		if f(im) {
+			items = append(items, im)
+			imindex.add(im)
+		}
+	}
+	d.items, d.index = items, imindex
+}
+
 func (d *db) list(key string) (out []string) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
@@ -159,12 +185,84 @@ func (d *db) list(key string) (out []string) {
 	return
 }
 
-// MemMonitor implements the uid.Monitor interface. Use an initialized version as provided by NewMemMonitor()
+// all returns a copy of all items in the database not expired at t
+func (d *db) all(t time.Time) (out []item) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	out = make([]item, 0, len(d.items))
+	for _, im := range d.items {
+		if im.Valid >= t.UnixNano() {
+			out = append(out, *im)
+		}
+	}
+	return
+}
+
+// groupMap holds the group mapping (group to member list). Lists never expire and every new list of a group
+// replaces the previous one
+type groupMap struct {
+	members map[string][]string
+	lock    *sync.Mutex
+}
+
+func newGroupMap() *groupMap {
+	return &groupMap{members: map[string][]string{}, lock: &sync.Mutex{}}
+}
+
+func (g *groupMap) set(group string, users []string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if len(users) == 0 {
+		delete(g.members, group)
+	} else {
+		g.members[group] = users
+	}
+}
+
+func (g *groupMap) clear() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.members = map[string][]string{}
+}
+
+// add appends user to the member list of group (if not already a member)
+func (g *groupMap) add(group, user string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for _, u := range g.members[group] {
+		if u == user {
+			return
+		}
+	}
+	g.members[group] = append(g.members[group], user)
+}
+
+func (g *groupMap) list(group string) (out []string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	out = append(out, g.members[group]...)
+	return
+}
+
+// all returns a copy of the group mapping
+func (g *groupMap) all() (out map[string][]string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	out = make(map[string][]string, len(g.members))
+	for group, users := range g.members {
+		out[group] = append([]string(nil), users...)
+	}
+	return
+}
+
+// MemMonitor implements the uid.Monitor interface (and its uid.PersistentMonitor and uid.GroupMonitor
+// extensions). Use an initialized version as provided by NewMemMonitor()
 type MemMonitor struct {
 	maxtout   time.Duration
 	userMap   *db
 	userGroup *db
 	ipTag     *db
+	groups    *groupMap
 	lock      *sync.Mutex
 }
 
@@ -179,15 +277,16 @@ func NewMemMonitor() (m *MemMonitor) {
 		userMap:   newDb(),
 		userGroup: newDb(),
 		ipTag:     newDb(),
+		groups:    newGroupMap(),
 		lock:      &sync.Mutex{},
 	}
 	return
 }
 
-// Log will process transactions generated by the UserID payload processing
-func (m *MemMonitor) Log(op uid.Operation, subject, value string, tout *uint) {
+func (m *MemMonitor) valid(op uid.Operation, tout *uint) int64 {
 	valid := time.Now()
-	if tout == nil {
+	// a zero timeout means the entry never expires (uid.NeverExpire)
+	if tout == nil || *tout == 0 {
 		valid = valid.Add(m.maxtout)
 	} else {
 		switch op {
@@ -197,32 +296,70 @@ func (m *MemMonitor) Log(op uid.Operation, subject, value string, tout *uint) {
 			valid = valid.Add(time.Second * time.Duration(*tout))
 		}
 	}
+	return valid.UnixNano()
+}
+
+func kind(tout *uint) int {
+	switch {
+	case tout == nil:
+		return defaultTTL
+	case *tout == 0:
+		return neverTTL
+	}
+	return timed
+}
+
+// Log will process transactions generated by the UserID payload processing
+func (m *MemMonitor) Log(op uid.Operation, subject, value string, tout *uint) {
 	switch op {
 	case uid.Login:
-		m.userMap.append(value, subject, valid.UnixNano())
+		m.userMap.append(value, subject, m.valid(op, tout), false, kind(tout))
 	case uid.Logout:
 		m.userMap.remove(value, subject)
 	case uid.Group:
-		m.userGroup.append(subject, value, valid.UnixNano())
+		m.userGroup.append(subject, value, m.valid(op, tout), false, kind(tout))
 	case uid.Ungroup:
 		m.userGroup.remove(subject, value)
 	case uid.Register:
-		m.ipTag.append(subject, value, valid.UnixNano())
+		m.ipTag.append(subject, value, m.valid(op, tout), false, kind(tout))
 	case uid.Unregister:
 		m.ipTag.remove(subject, value)
+	case uid.Membership:
+		// an empty value starts a new member list of the group, users are then added one at a time
+		if value == "" {
+			m.groups.set(subject, nil)
+		} else {
+			m.groups.add(subject, value)
+		}
 	}
 }
 
+// LogMembers implements the uid.GroupMonitor interface. The member list replaces the previous one of the
+// group. Group mapping entries are kept apart from user-to-group (DUG) ones and never expire
+func (m *MemMonitor) LogMembers(group string, users []string) {
+	m.groups.set(group, users)
+}
+
+// LogPersistent implements the uid.PersistentMonitor interface. Persistent ip-to-tag entries survive
+// a simulated device reboot (see Reboot())
+func (m *MemMonitor) LogPersistent(ip, tag string, tout *uint) {
+	m.ipTag.append(ip, tag, m.valid(uid.Register, tout), true, kind(tout))
+}
+
 // UserIP returns the list of IP's for a given user
 func (m *MemMonitor) UserIP(user string) []string {
 	return m.userMap.list(user)
 }
 
-// GroupIP returns the list of IP's for a given group of users
+// GroupIP returns the list of IP's for a given group of users (either user-to-group or group mapping members)
 func (m *MemMonitor) GroupIP(group string) (out []string) {
 	out = make([]string, 0, m.userMap.size)
-	for _, u := range m.userGroup.list(group) {
-		out = append(out, m.userMap.list(u)...)
+	seen := map[string]bool{}
+	for _, u := range append(m.userGroup.list(group), m.groups.list(group)...) {
+		if !seen[u] {
+			seen[u] = true
+			out = append(out, m.userMap.list(u)...)
+		}
 	}
 	return out
 }
@@ -232,6 +369,42 @@ func (m *MemMonitor) TagIP(tag string) []string {
 	return m.ipTag.list(tag)
 }
 
+// IPTags implements the uid.State interface. It returns the list of active ip-to-tag entries. Tout is the
+// remaining time to live in seconds (see uid.TagTimeout()), nil for entries logged without a timeout
+func (m *MemMonitor) IPTags() (out []uid.IPTag) {
+	t := time.Now()
+	items := m.ipTag.all(t)
+	out = make([]uid.IPTag, len(items))
+	for idx, im := range items {
+		out[idx] = uid.IPTag{IP: im.subject, Tag: im.key, Tout: timeout(im, t, uid.TagTimeout), Persistent: im.Persistent}
+	}
+	return
+}
+
+// UserMaps implements the uid.State interface. It returns the list of active user-to-ip entries. Tout is
+// the remaining time to live in minutes (see uid.LoginTimeout()), nil for entries logged without a timeout
+func (m *MemMonitor) UserMaps() (out []uid.UserMap) {
+	t := time.Now()
+	items := m.userMap.all(t)
+	out = make([]uid.UserMap, len(items))
+	for idx, im := range items {
+		out[idx] = uid.UserMap{IP: im.subject, User: im.key, Tout: timeout(im, t, uid.LoginTimeout)}
+	}
+	return
+}
+
+// UserGroups implements the uid.State interface. It returns the list of active user-to-group entries. Tout
+// is the remaining time to live in seconds (see uid.TagTimeout()), nil for entries logged without a timeout
+func (m *MemMonitor) UserGroups() (out []uid.UserGroup) {
+	t := time.Now()
+	items := m.userGroup.all(t)
+	out = make([]uid.UserGroup, len(items))
+	for idx, im := range items {
+		out[idx] = uid.UserGroup{User: im.subject, Group: im.key, Tout: timeout(im, t, uid.TagTimeout)}
+	}
+	return
+}
+
 // CleanUp triggers tge garbage collector (removes expired entries at t)
 func (m *MemMonitor) CleanUp(t time.Time) {
 	m.userMap.gb(t)
@@ -239,6 +412,97 @@ func (m *MemMonitor) CleanUp(t time.Time) {
 	m.ipTag.gb(t)
 }
 
+// Reboot simulates a device reboot: all user-to-ip, user-to-group, group mapping and non-persistent
+// ip-to-tag entries are removed
+func (m *MemMonitor) Reboot() {
+	none := func(*item) bool { return false }
+	m.userMap.keep(none)
+	m.userGroup.keep(none)
+	m.ipTag.keep(func(im *item) bool { return im.Persistent })
+	m.groups.clear()
+}
+
+// remaining returns the time to live of the item at t (NeverExpire for never expiring items)
+func remaining(im item, t time.Time) time.Duration {
+	if im.kind == neverTTL {
+		return uid.NeverExpire
+	}
+	return time.Duration(im.Valid - t.UnixNano())
+}
+
+// timeout returns the remaining time to live of the item at t converted by conv (0 for never expiring
+// items). It is nil for items logged without a timeout
+func timeout(im item, t time.Time, conv func(time.Duration) (*uint, error)) (tout *uint) {
+	if im.kind != defaultTTL {
+		tout, _ = conv(remaining(im, t))
+	}
+	return
+}
+
+// sorted sorts the items by subject and key
+func sorted(items []item) []item {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].subject != items[j].subject {
+			return items[i].subject < items[j].subject
+		}
+		return items[i].key < items[j].key
+	})
+	return items
+}
+
+/*
+Resync returns a UIDBuilder that replays all entries active at t. Its common use case
+is to restore the User-ID state of a rebooted device or to bootstrap a new one.
+
+User-to-ip, user-to-group and ip-to-tag entries are added with their remaining time
+to live as timeout (minutes for logins, seconds otherwise, rounded up). Entries logged
+without a timeout are added without one (device default) and entries logged with a
+zero timeout are added as never expiring ones. Group mapping lists (see
+LogMembers()) are added as they are. Entries are sorted by subject so the builder is
+deterministic.
+*/
+func (m *MemMonitor) Resync(t time.Time) (mp uid.UIDBuilder) {
+	mp = uid.NewUIDBuilder()
+	for _, im := range sorted(m.userMap.all(t)) {
+		if ttl := remaining(im, t); im.kind == defaultTTL {
+			mp = mp.LoginUser(im.key, im.subject, nil)
+		} else if ttl != 0 {
+			mp = mp.LoginUserFor(im.key, im.subject, ttl)
+		}
+	}
+	for _, im := range sorted(m.userGroup.all(t)) {
+		if ttl := remaining(im, t); im.kind == defaultTTL {
+			mp = mp.GroupUser(im.subject, im.key, nil)
+		} else if ttl != 0 {
+			mp = mp.GroupUserFor(im.subject, im.key, ttl)
+		}
+	}
+	members := m.groups.all()
+	groups := make([]string, 0, len(members))
+	for g := range members {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	for _, g := range groups {
+		mp = mp.SetGroupMembers(g, members[g])
+	}
+	for _, im := range sorted(m.ipTag.all(t)) {
+		ttl := remaining(im, t)
+		switch {
+		case im.kind == defaultTTL && im.Persistent:
+			mp = mp.RegisterIPPersistent(im.subject, im.key, nil)
+		case im.kind == defaultTTL:
+			mp = mp.RegisterIP(im.subject, im.key, nil)
+		case ttl == 0:
+		case im.Persistent:
+			mp = mp.RegisterIPPersistentFor(im.subject, im.key, ttl)
+		default:
+			mp = mp.RegisterIPFor(im.subject, im.key, ttl)
+		}
+	}
+	return
+}
+
 // Dump is a convenience method that dumps the memory database for troubleshooting purposes
 func (m *MemMonitor) Dump() (out string) {
 	m.lock.Lock()
@@ -247,7 +511,8 @@ func (m *MemMonitor) Dump() (out string) {
 		UserIp    index
 		GroupUser index
 		TagIP     index
-	}{m.userMap.index, m.userGroup.index, m.ipTag.index}
+		Groups    map[string][]string
+	}{m.userMap.index, m.userGroup.index, m.ipTag.index, m.groups.all()}
 	if o, err := json.MarshalIndent(j, "", "  "); err == nil {
 		out = string(o)
 	}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	x "github.com/xhoms/panoslib/collection"
 	"github.com/xhoms/panoslib/uid"
 	"github.com/xhoms/panoslib/uidmonitor"
 )
@@ -61,6 +62,223 @@ func TestMonitor(t *testing.T) {
 	t.Error(err)
 }
 
+func TestMonitorReboot(t *testing.T) {
+	c := uidmonitor.NewMemMonitor()
+	var err error
+	if _, err = uid.NewUIDBuilder().
+		LoginUser("a1@test.local", "1.1.1.1", nil).
+		GroupUser("a1@test.local", "a", nil).
+		RegisterIP("1.1.1.1", "good", nil).
+		RegisterIPPersistent("2.2.2.2", "good", nil).
+		Payload(c); err == nil {
+		c.Reboot()
+		if len(c.UserIP("a1@test.local")) == 0 &&
+			len(c.GroupIP("a")) == 0 &&
+			len(c.TagIP("good")) == 1 &&
+			c.TagIP("good")[0] == "2.2.2.2" {
+			return
+		}
+		err = errors.New("recovery error")
+	}
+	t.Error(err)
+}
+
+func TestMonitorMembership(t *testing.T) {
+	c := uidmonitor.NewMemMonitor()
+	if _, err := uid.NewUIDBuilder().
+		LoginUser("a1@test.local", "1.1.1.1", nil).
+		LoginUser("a2@test.local", "2.2.2.2", nil).
+		SetGroupMembers("a", []string{"a1@test.local", "a2@test.local"}).
+		Payload(c); err != nil || len(c.GroupIP("a")) != 2 {
+		t.Error("group membership not tracked")
+	}
+}
+
+func TestMonitorGroupMapping(t *testing.T) {
+	c := uidmonitor.NewMemMonitor()
+	var tout uint = 10
+	if _, err := uid.NewUIDBuilder().
+		LoginUser("a1@test.local", "1.1.1.1", nil).
+		LoginUser("a2@test.local", "2.2.2.2", nil).
+		LoginUser("a3@test.local", "3.3.3.3", nil).
+		GroupUser("a1@test.local", "a", &tout).
+		SetGroupMembers("a", []string{"a1@test.local", "a2@test.local"}).
+		SetGroupMembers("b", []string{"a3@test.local"}).
+		Payload(c); err != nil {
+		t.Fatal(err)
+	}
+	// the group mapping does not turn the timed user-to-group entry into a never expiring one
+	c.CleanUp(time.Now().Add(time.Minute))
+	if len(c.UserGroups()) != 0 || len(c.GroupIP("a")) != 2 {
+		t.Fatalf("unexpected user-to-group entries %v (%v)", c.UserGroups(), c.GroupIP("a"))
+	}
+	// ungroup does not remove group mapping members while new lists replace the previous ones
+	if _, err := uid.NewUIDBuilder().
+		UngroupUser("a2@test.local", "a").
+		SetGroupMembers("a", []string{"a2@test.local"}).
+		SetGroupMembers("b", []string{}).
+		Payload(c); err != nil {
+		t.Fatal(err)
+	}
+	if ips := c.GroupIP("a"); len(ips) != 1 || ips[0] != "2.2.2.2" || len(c.GroupIP("b")) != 0 {
+		t.Errorf("unexpected group mapping a: %v b: %v", ips, c.GroupIP("b"))
+	}
+}
+
+// tee forwards the log entries to a MemMonitor through the plain Monitor interface
+type tee struct {
+	m *uidmonitor.MemMonitor
+}
+
+func (t tee) Log(op uid.Operation, subject, value string, tout *uint) {
+	t.m.Log(op, subject, value, tout)
+}
+
+func TestMonitorMembershipLog(t *testing.T) {
+	c := uidmonitor.NewMemMonitor()
+	for _, users := range [][]string{{"a1@test.local", "a2@test.local"}, {"a2@test.local"}} {
+		if _, err := uid.NewUIDBuilder().
+			LoginUser("a1@test.local", "1.1.1.1", nil).
+			LoginUser("a2@test.local", "2.2.2.2", nil).
+			SetGroupMembers("a", users).
+			Payload(tee{c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the new list replaces the previous one even if the monitor only gets Log() calls
+	if ips := c.GroupIP("a"); len(ips) != 1 || ips[0] != "2.2.2.2" {
+		t.Errorf("unexpected group mapping %v", ips)
+	}
+}
+
+func TestMonitorNeverExpire(t *testing.T) {
+	c := uidmonitor.NewMemMonitor()
+	if _, err := uid.NewUIDBuilder().
+		LoginUserFor("a1@test.local", "1.1.1.1", uid.NeverExpire).
+		RegisterIPFor("1.1.1.1", "good", uid.NeverExpire).
+		Payload(c); err != nil {
+		t.Fatal(err)
+	}
+	c.CleanUp(time.Now().Add(time.Hour))
+	if len(c.UserIP("a1@test.local")) != 1 || len(c.TagIP("good")) != 1 {
+		t.Error("never expiring entries removed")
+	}
+}
+
+func TestMonitorResync(t *testing.T) {
+	c := uidmonitor.NewMemMonitor()
+	var tout, short uint = 10, 2
+	var err error
+	if _, err = uid.NewUIDBuilder().
+		LoginUser("a1@test.local", "1.1.1.1", &tout).
+		LoginUser("a2@test.local", "2.2.2.2", nil).
+		GroupUser("a1@test.local", "a", &tout).
+		GroupUserFor("a2@test.local", "a", uid.NeverExpire).
+		SetGroupMembers("admin", []string{"a2@test.local", "a1@test.local"}).
+		RegisterIP("1.1.1.1", "good", &tout).
+		RegisterIPPersistent("2.2.2.2", "good", nil).
+		RegisterIP("3.3.3.3", "bad", &short).
+		Payload(c); err != nil {
+		t.Fatal(err)
+	}
+	// five seconds later: logins round up to 10 minutes, tags and groups round up to 5 seconds
+	// and the 3.3.3.3 registration is gone
+	c.CleanUp(time.Now().Add(5 * time.Second))
+	mp := c.Resync(time.Now().Add(5 * time.Second))
+	if mp.Err() != nil || mp.Len() != 7 {
+		t.Fatalf("unexpected resync builder (%v entries): %v", mp.Len(), mp.Err())
+	}
+	r := uidmonitor.NewMemMonitor()
+	p, _ := mp.Payload(r)
+	if len(r.UserIP("a1@test.local")) == 1 && len(r.GroupIP("admin")) == 2 && len(r.TagIP("good")) == 2 &&
+		p.Login != nil && *p.Login.Entry[0].Timeout == "10" && p.Login.Entry[1].Timeout == nil &&
+		p.RegisterUser != nil && *p.RegisterUser.Entry[0].Tag.Member[0].Timeout == "5" &&
+		*p.RegisterUser.Entry[1].Tag.Member[0].Timeout == "0" &&
+		p.Groups != nil && len(p.Groups.Entry[0].Members.Entry) == 2 &&
+		p.Register != nil && len(p.Register.Entry) == 2 && *p.Register.Entry[0].Tag.Member[0].Timeout == "5" &&
+		p.Register.Entry[1].Persistent == "1" && p.Register.Entry[1].Tag.Member[0].Timeout == nil {
+		return
+	}
+	t.Errorf("unexpected resync payload %+v", p)
+}
+
+func TestMonitorResyncGroups(t *testing.T) {
+	c := uidmonitor.NewMemMonitor()
+	var tout uint = 600
+	var err error
+	if _, err = uid.NewUIDBuilder().
+		GroupUser("a1@test.local", "a", &tout).
+		SetGroupMembers("a", []string{"a1@test.local", "a2@test.local"}).
+		SetGroupMembers("b", []string{"a2@test.local"}).
+		Payload(c); err == nil {
+		// removed memberships are not replayed
+		_, err = uid.NewUIDBuilder().SetGroupMembers("b", []string{}).Payload(c)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p *x.UIDMsgPayload
+	if p, err = c.Resync(time.Now()).Payload(nil); err == nil {
+		if p.RegisterUser != nil && len(p.RegisterUser.Entry) == 1 &&
+			p.RegisterUser.Entry[0].Tag.Member[0].Timeout != nil && *p.RegisterUser.Entry[0].Tag.Member[0].Timeout == "600" &&
+			p.Groups != nil && len(p.Groups.Entry) == 1 && p.Groups.Entry[0].Name == "a" &&
+			len(p.Groups.Entry[0].Members.Entry) == 2 {
+			return
+		}
+		err = fmt.Errorf("unexpected resync payload %+v %+v", p.RegisterUser, p.Groups)
+	}
+	t.Error(err)
+}
+
+func TestMonitorRemoveAll(t *testing.T) {
+	c := uidmonitor.NewMemMonitor()
+	var err error
+	if _, err = uid.NewUIDBuilder().
+		LoginUser("a1@test.local", "1.1.1.1", nil).
+		LoginUser("a1@test.local", "2.2.2.2", nil).
+		GroupUser("a1@test.local", "a", nil).
+		SetGroupMembers("admin", []string{"a1@test.local"}).
+		RegisterIP("1.1.1.1", "quarantine", nil).
+		RegisterIP("2.2.2.2", "quarantine", nil).
+		Payload(c); err == nil {
+		if _, err = uid.NewUIDBuilder().
+			UnregisterTag("quarantine", c).
+			LogoutAllForUser("a1@test.local", c).
+			UngroupAllForUser("a1@test.local", c).
+			Payload(c); err == nil {
+			// group mapping entries are not ungrouped
+			if len(c.TagIP("quarantine")) == 0 && len(c.UserIP("a1@test.local")) == 0 &&
+				len(c.GroupIP("a")) == 0 && len(c.UserGroups()) == 0 {
+				return
+			}
+			err = errors.New("recovery error")
+		}
+	}
+	t.Error(err)
+}
+
+func TestMonitorReconcile(t *testing.T) {
+	c := uidmonitor.NewMemMonitor()
+	var err error
+	if _, err = uid.NewUIDBuilder().
+		LoginUser("a1@test.local", "1.1.1.1", nil).
+		RegisterIP("1.1.1.1", "good", nil).
+		RegisterIP("2.2.2.2", "good", nil).
+		Payload(c); err == nil {
+		desired := &uid.Snapshot{
+			IPTag:   []uid.IPTag{{IP: "1.1.1.1", Tag: "good"}},
+			UserMap: []uid.UserMap{{User: "a1@test.local", IP: "1.1.1.1"}},
+		}
+		if _, err = uid.Reconcile(desired, c).Payload(c); err == nil {
+			if len(c.TagIP("good")) == 1 && len(c.UserIP("a1@test.local")) == 1 {
+				return
+			}
+			err = errors.New("recovery error")
+		}
+	}
+	t.Error(err)
+}
+
 func ExampleNewMemMonitor() {
 	now := time.Now()
 	t1 := now.Add(10 * time.Second)
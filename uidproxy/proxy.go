@@ -0,0 +1,271 @@
+/*
+package uidproxy provides a "man-in-the-middle" http.Handler for the PAN-OS XML User-ID API.
+
+Existing User-ID agents are pointed to the Proxy instead of to the firewall. Every uid-message received
+is decoded into a uid.UIDBuilder (see uid.NewBuilderFromPayload()), processed by a chain of hooks that can
+rewrite, filter or augment it and forwarded to one or more upstream devices. The entries applied by the
+upstream devices are logged to a Monitor and the reply to the agent is built from the results of all of
+them (see Proxy.Upstream).
+
+	p := &uidproxy.Proxy{
+		Upstream: []uid.Target{{HostPort: "fw1.test.local", APIKey: "key1"}, {HostPort: "fw2.test.local", APIKey: "key2"}},
+		Client:   http.DefaultClient,
+		APIKey:   "agentkey",
+		Monitor:  uidmonitor.NewMemMonitor(),
+		Hooks: []uidproxy.Hook{func(r *http.Request, mp uid.UIDBuilder) (uid.UIDBuilder, error) {
+			return mp.RegisterIP("10.0.0.1", "proxied", nil), nil
+		}},
+	}
+	http.ListenAndServeTLS(":443", "cert.pem", "key.pem", p)
+*/
+package uidproxy
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	x "github.com/xhoms/panoslib/collection"
+	"github.com/xhoms/panoslib/uid"
+)
+
+// Hook processes the UIDBuilder decoded from an incoming request and returns the one to be forwarded.
+// Returning an error rejects the request (nothing is logged nor forwarded)
+type Hook func(r *http.Request, mp uid.UIDBuilder) (uid.UIDBuilder, error)
+
+// Proxy is an http.Handler that relays User-ID API requests to the Upstream devices
+type Proxy struct {
+	// Upstream is the list of devices the messages are forwarded to. Targets without Vsys inherit the one
+	// of the incoming request. A device accepts the message if it replies with a "success" response or with
+	// per-entry results (see uid.PartialError). The reply to the caller is:
+	//   - the response of the first device, as is, if all of them accepted the message
+	//   - a 502 error if none of them accepted it
+	//   - otherwise an "error" response with the per-entry results of the first device that accepted the
+	//     message plus a line for every device that didn't. Agents will send the message again, which is
+	//     harmless for the devices that already applied it
+	Upstream []uid.Target
+	Client   uid.Client
+	// APIKey is the key incoming requests must provide (either in the form values or in the X-PAN-KEY
+	// header). All requests are refused if it is empty unless Insecure is set
+	APIKey string
+	// Insecure allows serving requests without authentication when APIKey is empty. Keep in mind the
+	// Proxy uses the Upstream keys so it becomes an open relay to the upstream devices
+	Insecure bool
+	// Monitor receives a log entry for every entry in the forwarded messages applied by at least one of the
+	// Upstream devices (can be nil)
+	Monitor uid.Monitor
+	// Hooks are applied in order to every incoming message
+	Hooks []Hook
+	// Retry is the policy applied to each upstream device (nil means a single attempt)
+	Retry *uid.RetryPolicy
+	// ErrorLog is the logger for upstream errors (nil means errors are not logged)
+	ErrorLog *log.Logger
+}
+
+// upstream is the outcome of forwarding a message to a single device
+type upstream struct {
+	status      int
+	contentType string
+	body        []byte
+	apiResp     *x.APIResponse
+	err         error
+}
+
+// accepted returns true if the device processed the message
+func (u upstream) accepted() bool {
+	var perr *uid.PartialError
+	return u.err == nil || (u.apiResp != nil && errors.As(u.err, &perr))
+}
+
+func (p *Proxy) logf(format string, args ...interface{}) {
+	if p.ErrorLog != nil {
+		p.ErrorLog.Printf(format, args...)
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		replyError(w, http.StatusBadRequest, 18, "Malformed Request")
+		return
+	}
+	if p.APIKey == "" && !p.Insecure {
+		p.logf("uidproxy: request refused, no APIKey configured")
+		replyError(w, http.StatusForbidden, 403, "Invalid Credential")
+		return
+	}
+	if p.APIKey != "" {
+		key := r.Header.Get("X-PAN-KEY")
+		if key == "" {
+			key = r.Form.Get("key")
+		}
+		if subtle.ConstantTimeCompare([]byte(key), []byte(p.APIKey)) != 1 {
+			replyError(w, http.StatusForbidden, 403, "Invalid Credential")
+			return
+		}
+	}
+	if r.Form.Get("type") != "user-id" {
+		replyError(w, http.StatusBadRequest, 18, "Malformed Request")
+		return
+	}
+	u := &x.UIDMessage{}
+	if err := xml.Unmarshal([]byte(r.Form.Get("cmd")), u); err != nil {
+		replyError(w, http.StatusOK, 18, "Malformed Request")
+		return
+	}
+	mp := uid.NewBuilderFromPayload(u.Payload)
+	for _, hook := range p.Hooks {
+		var err error
+		if mp, err = hook(r, mp); err != nil {
+			replyError(w, http.StatusOK, 18, err.Error())
+			return
+		}
+	}
+	pld, err := mp.Payload(nil)
+	if err != nil {
+		replyError(w, http.StatusOK, 18, err.Error())
+		return
+	}
+	if empty(pld) || len(p.Upstream) == 0 {
+		reply(w, http.StatusOK, "", []byte(`<response status="success"><result><uid-response><version>2.0</version><payload></payload></uid-response></result></response>`))
+		return
+	}
+	res := p.forward(r, mp)
+	if p.Monitor != nil {
+		applied(mp, res).Payload(p.Monitor)
+	}
+	p.reply(w, res)
+}
+
+// entryKey identifies an entry of a builder
+type entryKey struct {
+	op             uid.Operation
+	subject, value string
+}
+
+// applied returns the entries of mp that at least one upstream device accepted and didn't report as failed
+func applied(mp uid.UIDBuilder, res []upstream) uid.UIDBuilder {
+	ok := map[entryKey]bool{}
+	for _, u := range res {
+		if !u.accepted() {
+			continue
+		}
+		failed := map[entryKey]bool{}
+		var perr *uid.PartialError
+		if errors.As(u.err, &perr) {
+			mp.Failed(perr.Entries).Each(func(e uid.Entry) bool {
+				failed[entryKey{e.Op, e.Subject, e.Value}] = true
+				return true
+			})
+		}
+		mp.Each(func(e uid.Entry) bool {
+			if k := (entryKey{e.Op, e.Subject, e.Value}); !failed[k] {
+				ok[k] = true
+			}
+			return true
+		})
+	}
+	return mp.Filter(func(e uid.Entry) bool { return ok[entryKey{e.Op, e.Subject, e.Value}] })
+}
+
+// reply builds the response to the caller from the upstream results (see Upstream)
+func (p *Proxy) reply(w http.ResponseWriter, res []upstream) {
+	var first *upstream
+	failed := []x.APIResponseLine{}
+	for idx := range res {
+		switch {
+		case !res[idx].accepted():
+			failed = append(failed, x.APIResponseLine{Text: fmt.Sprintf("upstream %v of %v failed", idx+1, len(res))})
+		case first == nil:
+			first = &res[idx]
+		}
+	}
+	switch {
+	case first == nil:
+		replyError(w, http.StatusBadGateway, 0, "upstream unavailable")
+	case len(failed) == 0:
+		reply(w, res[0].status, res[0].contentType, res[0].body)
+	default:
+		resp := x.APIResponse{Status: "error", Msg: &x.APIResponseMsg{}}
+		if first.apiResp.Result != nil && first.apiResp.Result.UidResponse != nil {
+			resp.Msg.Line = append(resp.Msg.Line, x.APIResponseLine{UidResponse: first.apiResp.Result.UidResponse})
+		}
+		if first.apiResp.Msg != nil {
+			for _, l := range first.apiResp.Msg.Line {
+				if l.UidResponse != nil {
+					resp.Msg.Line = append(resp.Msg.Line, x.APIResponseLine{UidResponse: l.UidResponse})
+				}
+			}
+		}
+		resp.Msg.Line = append(resp.Msg.Line, failed...)
+		body, _ := xml.Marshal(resp)
+		reply(w, http.StatusOK, "", body)
+	}
+}
+
+// forward pushes the message to all upstream devices concurrently
+func (p *Proxy) forward(r *http.Request, mp uid.UIDBuilder) (res []upstream) {
+	res = make([]upstream, len(p.Upstream))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(p.Upstream))
+	for idx := range p.Upstream {
+		go func(idx int) {
+			defer wg.Done()
+			t := p.Upstream[idx]
+			if t.Vsys == "" {
+				t.Vsys = r.Form.Get("vsys")
+			}
+			res[idx] = p.push(r, t, mp)
+		}(idx)
+	}
+	wg.Wait()
+	return
+}
+
+func (p *Proxy) push(r *http.Request, t uid.Target, mp uid.UIDBuilder) (out upstream) {
+	resp, err := mp.PushTarget(r.Context(), t, p.Client, nil, p.Retry)
+	if err == nil {
+		out.status = resp.StatusCode
+		out.contentType = resp.Header.Get("Content-Type")
+		out.body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if err == nil {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(out.body))
+		out.apiResp, err = uid.Validate(resp, nil)
+	}
+	if out.err = err; err != nil {
+		p.logf("uidproxy: upstream %v: %v", t.HostPort, uid.Redact(err, t.APIKey))
+	}
+	return
+}
+
+func empty(p *x.UIDMsgPayload) bool {
+	return p.Register == nil && p.Unregister == nil &&
+		p.RegisterUser == nil && p.UnregisterUser == nil &&
+		p.Login == nil && p.Logout == nil && p.Groups == nil
+}
+
+func reply(w http.ResponseWriter, status int, contentType string, body []byte) {
+	if contentType == "" {
+		contentType = "application/xml; charset=UTF-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func replyError(w http.ResponseWriter, status, code int, msg string) {
+	resp := x.APIResponse{Status: "error", Msg: &x.APIResponseMsg{Text: msg}}
+	if code != 0 {
+		resp.Code = strconv.Itoa(code)
+	}
+	body, _ := xml.Marshal(resp)
+	reply(w, status, "", body)
+}
@@ -0,0 +1,198 @@
+package uidproxy_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xhoms/panoslib/panostest"
+	"github.com/xhoms/panoslib/uid"
+	"github.com/xhoms/panoslib/uidmonitor"
+	"github.com/xhoms/panoslib/uidproxy"
+)
+
+func upstream(apikey string) (h *panostest.Handler, srv *httptest.Server, t uid.Target) {
+	h = panostest.NewHandler(uidmonitor.NewMemMonitor(), apikey)
+	srv = httptest.NewTLSServer(h)
+	t = uid.Target{HostPort: srv.Listener.Addr().String(), APIKey: apikey}
+	return
+}
+
+func TestProxy(t *testing.T) {
+	h1, srv1, t1 := upstream("key1")
+	defer srv1.Close()
+	h2, srv2, t2 := upstream("key2")
+	defer srv2.Close()
+	m := uidmonitor.NewMemMonitor()
+	p := &uidproxy.Proxy{
+		Upstream: []uid.Target{t1, t2},
+		Client:   srv1.Client(),
+		APIKey:   "agentkey",
+		Monitor:  m,
+		Hooks: []uidproxy.Hook{func(r *http.Request, mp uid.UIDBuilder) (uid.UIDBuilder, error) {
+			return mp.RegisterIP("10.0.0.1", "proxied", nil), nil
+		}},
+	}
+	srv := httptest.NewTLSServer(p)
+	defer srv.Close()
+	_, err := uid.Validate(uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		Push(srv.Listener.Addr().String(), "agentkey", srv.Client(), nil))
+	if err == nil {
+		for _, mon := range []*uidmonitor.MemMonitor{h1.Monitor(), h2.Monitor(), m} {
+			if len(mon.TagIP("foo")) != 1 || len(mon.TagIP("proxied")) != 1 {
+				err = errors.New("message not forwarded")
+			}
+		}
+		if err == nil {
+			return
+		}
+	}
+	t.Error(err)
+}
+
+func TestProxyRelay(t *testing.T) {
+	_, srv1, t1 := upstream("key1")
+	defer srv1.Close()
+	p := &uidproxy.Proxy{Upstream: []uid.Target{t1}, Client: srv1.Client(), Insecure: true}
+	srv := httptest.NewTLSServer(p)
+	defer srv.Close()
+	mp := uid.NewUIDBuilder().RegisterIP("1.1.1.1", "foo", nil)
+	hostport := srv.Listener.Addr().String()
+	if _, err := uid.Validate(mp.Push(hostport, "any", srv.Client(), nil)); err != nil {
+		t.Fatal(err)
+	}
+	// the upstream per-entry error is relayed as is
+	_, err := uid.Validate(mp.Push(hostport, "any", srv.Client(), nil))
+	var perr *uid.PartialError
+	if errors.As(err, &perr) {
+		if len(perr.Entries) == 1 && perr.Entries[0].Kind == uid.KindAlreadyExists {
+			return
+		}
+		err = fmt.Errorf("unexpected entries %+v", perr.Entries)
+	}
+	t.Error(err)
+}
+
+func TestProxyNoKey(t *testing.T) {
+	h1, srv1, t1 := upstream("key1")
+	defer srv1.Close()
+	p := &uidproxy.Proxy{Upstream: []uid.Target{t1}, Client: srv1.Client()}
+	srv := httptest.NewTLSServer(p)
+	defer srv.Close()
+	_, err := uid.Validate(uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		Push(srv.Listener.Addr().String(), "any", srv.Client(), nil))
+	var aerr *uid.APIError
+	if errors.As(err, &aerr) && aerr.IsAuth() && h1.Requests() == 0 {
+		return
+	}
+	t.Errorf("expected the request to be refused, got %v", err)
+}
+
+func TestProxyReject(t *testing.T) {
+	h1, srv1, t1 := upstream("key1")
+	defer srv1.Close()
+	p := &uidproxy.Proxy{
+		Upstream: []uid.Target{t1},
+		Client:   srv1.Client(),
+		Insecure: true,
+		Hooks: []uidproxy.Hook{func(r *http.Request, mp uid.UIDBuilder) (uid.UIDBuilder, error) {
+			return mp, errors.New("not allowed")
+		}},
+	}
+	srv := httptest.NewTLSServer(p)
+	defer srv.Close()
+	_, err := uid.Validate(uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		Push(srv.Listener.Addr().String(), "any", srv.Client(), nil))
+	var aerr *uid.APIError
+	if errors.As(err, &aerr) && aerr.Message == "not allowed" && h1.Requests() == 0 {
+		return
+	}
+	t.Errorf("expected the request to be rejected, got %v", err)
+}
+
+func TestProxyUpstreamDown(t *testing.T) {
+	h1, srv1, t1 := upstream("key1")
+	defer srv1.Close()
+	h1.Inject(panostest.Fault{Status: http.StatusServiceUnavailable})
+	_, srv2, t2 := upstream("key2")
+	srv2.Close()
+	buf := &bytes.Buffer{}
+	m := uidmonitor.NewMemMonitor()
+	p := &uidproxy.Proxy{
+		Upstream: []uid.Target{t2, t1},
+		Client:   srv1.Client(),
+		Insecure: true,
+		Monitor:  m,
+		ErrorLog: log.New(buf, "", 0),
+	}
+	srv := httptest.NewTLSServer(p)
+	defer srv.Close()
+	_, err := uid.Validate(uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		Push(srv.Listener.Addr().String(), "any", srv.Client(), nil))
+	var aerr *uid.APIError
+	if !errors.As(err, &aerr) || aerr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected a bad gateway error, got %v", err)
+	}
+	if len(m.TagIP("foo")) != 0 {
+		t.Error("entries not applied by any upstream logged to the monitor")
+	}
+	if logs := buf.String(); strings.Count(logs, "\n") != 2 || strings.Contains(logs, "key1") || strings.Contains(logs, "key2") {
+		t.Errorf("unexpected error log %q", logs)
+	}
+}
+
+func TestProxyPartialUpstream(t *testing.T) {
+	h1, srv1, t1 := upstream("key1")
+	defer srv1.Close()
+	_, srv2, t2 := upstream("key2")
+	srv2.Close()
+	// the outcome must not depend on the order of the upstream devices
+	for idx, targets := range [][]uid.Target{{t1, t2}, {t2, t1}} {
+		p := &uidproxy.Proxy{Upstream: targets, Client: srv1.Client(), APIKey: "agentkey"}
+		srv := httptest.NewTLSServer(p)
+		_, err := uid.Validate(uid.NewUIDBuilder().
+			RegisterIP(fmt.Sprintf("1.1.1.%v", idx+1), "foo", nil).
+			Push(srv.Listener.Addr().String(), "agentkey", srv.Client(), nil))
+		srv.Close()
+		var aerr *uid.APIError
+		if !errors.As(err, &aerr) || aerr.StatusCode != http.StatusOK || !strings.Contains(aerr.Message, "failed") {
+			t.Errorf("expected a partial upstream error, got %v", err)
+		}
+	}
+	if len(h1.Monitor().TagIP("foo")) != 2 {
+		t.Error("message not forwarded to the available upstream")
+	}
+}
+
+func TestProxyMonitorFailed(t *testing.T) {
+	srv1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<response status="error"><msg><line><uid-response><version>2.0</version><payload><register>` +
+			`<entry ip="1.1.1.1" message="tag bar failed, limit reached"/></register></payload></uid-response></line></msg></response>`))
+	}))
+	defer srv1.Close()
+	m := uidmonitor.NewMemMonitor()
+	p := &uidproxy.Proxy{
+		Upstream: []uid.Target{{HostPort: srv1.Listener.Addr().String(), APIKey: "key1"}},
+		Client:   srv1.Client(),
+		Insecure: true,
+		Monitor:  m,
+	}
+	srv := httptest.NewTLSServer(p)
+	defer srv.Close()
+	uid.Validate(uid.NewUIDBuilder().
+		RegisterIP("1.1.1.1", "foo", nil).
+		RegisterIP("1.1.1.1", "bar", nil).
+		Push(srv.Listener.Addr().String(), "any", srv.Client(), nil))
+	if len(m.TagIP("foo")) != 1 || len(m.TagIP("bar")) != 0 {
+		t.Errorf("expected only the applied entry in the monitor, got %v", m.IPTags())
+	}
+}